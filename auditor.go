@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type AuditEvt struct{}
+
+// Periodically makes the tablemanager check that no money has been lost or created out of thin air
+func RunAuditor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		<-ticker.C
+		tableManager.EvtChan <- &AuditEvt{}
+	}
+}
+
+// Audit sums up all wallets and chips on the tables and compares it to the money that has come from faucets.
+// Money being in the middle of moving can cause a false drift so it has to be seen twice in a row before alerting.
+func (t *TableManager) Audit() {
+	for _, tbl := range t.tables {
+		tbl.Lock()
+	}
+
+	tableChips := 0
+	for _, tbl := range t.tables {
+		tableChips += tbl.MoneyAtTable()
+	}
+	for _, snapshot := range t.snapshots {
+		tableChips += snapshot.Chips()
+	}
+	for _, mtt := range t.mtts {
+		mtt.Lock()
+		tableChips += mtt.Pool
+		mtt.Unlock()
+	}
+	wallets := playerManager.TotalMoney()
+	faucets := playerManager.Ledger.Faucets()
+
+	for _, tbl := range t.tables {
+		tbl.Unlock()
+	}
+
+	drift := wallets + tableChips - faucets
+	if drift == 0 {
+		t.pendingDrift = 0
+		t.alertedDrift = 0
+		return
+	}
+
+	if drift != t.pendingDrift {
+		t.pendingDrift = drift
+		return
+	}
+
+	if drift != t.alertedDrift {
+		t.alertedDrift = drift
+		msg := fmt.Sprintf("Money drift detected: wallets $%d + tables $%d = $%d, expected $%d from faucets (drift %+d)",
+			wallets, tableChips, wallets+tableChips, faucets, drift)
+		log.Println(msg)
+		t.AlertOwner(msg)
+	}
+}
+
+// Sends a private message to the bot owner if one is set
+func (t *TableManager) AlertOwner(msg string) {
+	if flagOwner == "" || t.Transport == nil {
+		return
+	}
+
+	t.Transport.SendPrivateMessage(flagOwner, msg)
+}
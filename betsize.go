@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/table"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const betSizeHelp = "like 40, to 60, 3bb, 3x, 2/3, 75%, half pot, pot, min or max"
+
+// What bet sizes are resolved against, taken when the player acts. Amounts are what's put in on top of a call,
+// the same as MinRaise and MaxRaise
+type BetContext struct {
+	MinRaise    int
+	MaxRaise    int
+	Pot         int
+	Outstanding int // Chips needed to call
+	CurrentBet  int // Biggest bet this street, 0 if nobody bet yet
+	BigBlind    int
+}
+
+// Returns the context for the player that's acting, table should be locked
+func (t *Table) betContext() *BetContext {
+	ctx := &BetContext{
+		MinRaise:    t.Table.MinRaise(),
+		MaxRaise:    t.Table.MaxRaise(),
+		Pot:         t.Table.Pot().Chips(),
+		Outstanding: t.Table.Outstanding(),
+		BigBlind:    t.Table.Stakes().BigBet,
+	}
+
+	for _, v := range t.streetBets() {
+		if v > ctx.CurrentBet {
+			ctx.CurrentBet = v
+		}
+	}
+
+	// Nobody puts in less than they need to call
+	if ctx.CurrentBet < ctx.Outstanding {
+		ctx.CurrentBet = ctx.Outstanding
+	}
+	return ctx
+}
+
+// Returns the chips everyone put in this street by seat, antes don't count. Table should be locked
+func (t *Table) streetBets() map[int]int {
+	bets := make(map[int]int)
+	if t.history == nil {
+		return bets
+	}
+
+	street := t.street()
+	for _, a := range t.history.Actions {
+		if a.Street == street && a.Action != postAnte {
+			bets[a.Seat] += a.Amount
+		}
+	}
+	return bets
+}
+
+// ResolveBet turns what was written after bet or raise into chips. Understands plain amounts, "to" amounts,
+// big blinds (3bb), multiples of the current bet (3x), shares of the pot (2/3, 75%, half pot, pot) and min/max
+func ResolveBet(size string, ctx *BetContext) (int, error) {
+	size = strings.Join(strings.Fields(strings.ToLower(size)), " ")
+	if size == "" {
+		return 0, errors.New("Try again by also specifying amount, " + betSizeHelp)
+	}
+
+	switch size {
+	case "min":
+		return ctx.MinRaise, nil
+	case "max", "all", "all in", "allin":
+		return ctx.MaxRaise, nil
+	}
+
+	if strings.HasPrefix(size, "to ") {
+		to, err := parseBetNumber(strings.TrimPrefix(size, "to "))
+		if err != nil {
+			return 0, err
+		}
+		return checkBetRange(fmt.Sprintf("Going to %d", to), to-ctx.CurrentBet, ctx)
+	}
+
+	if strings.HasSuffix(size, "bb") {
+		n, err := parseBetFloat(strings.TrimSuffix(size, "bb"))
+		if err != nil {
+			return 0, err
+		}
+		chips := int(math.Round(n * float64(ctx.BigBlind)))
+		return checkBetRange(fmt.Sprintf("%s big blinds is %d", strings.TrimSuffix(size, "bb"), chips), chips, ctx)
+	}
+
+	if strings.HasSuffix(size, "x") {
+		if ctx.CurrentBet < 1 {
+			return 0, errors.New("There's no bet to multiply yet, bet an amount or a share of the pot instead")
+		}
+		n, err := parseBetFloat(strings.TrimSuffix(size, "x"))
+		if err != nil {
+			return 0, err
+		}
+		if n <= 1 {
+			return 0, errors.New("Multiply the bet by more than 1, like 3x")
+		}
+
+		// 3x is a raise to 3 times the bet
+		chips := int(math.Round((n - 1) * float64(ctx.CurrentBet)))
+		return checkBetRange(fmt.Sprintf("%sx the bet is a raise of %d", strings.TrimSuffix(size, "x"), chips), chips, ctx)
+	}
+
+	if share, ok, err := parsePotShare(size); ok {
+		if err != nil {
+			return 0, err
+		}
+
+		// A pot sized raise is calling and then betting the pot after the call
+		chips := int(math.Round(share * float64(ctx.Pot+ctx.Outstanding)))
+		return checkBetRange(fmt.Sprintf("That share of the pot is %d", chips), chips, ctx)
+	}
+
+	chips, err := parseBetNumber(size)
+	if err != nil {
+		return 0, err
+	}
+	if chips <= 0 {
+		return 0, errors.New("Can't raise/bet anythign less then 1 >:(")
+	}
+	return chips, nil
+}
+
+// Parses sizes relative to the pot, ok is false if it isn't one
+func parsePotShare(size string) (share float64, ok bool, err error) {
+	trimmed := strings.TrimSpace(strings.TrimSuffix(size, "pot"))
+	switch trimmed {
+	case "", "full":
+		return 1, true, nil
+	case "half", "1/2":
+		return 0.5, true, nil
+	case "quarter", "1/4":
+		return 0.25, true, nil
+	}
+
+	if strings.HasSuffix(trimmed, "%") {
+		n, err := parseBetFloat(strings.TrimSuffix(trimmed, "%"))
+		return n / 100, true, err
+	}
+
+	if split := strings.SplitN(trimmed, "/", 2); len(split) == 2 {
+		num, err := parseBetFloat(split[0])
+		if err != nil {
+			return 0, true, err
+		}
+		den, err := parseBetFloat(split[1])
+		if err != nil || den == 0 {
+			return 0, true, fmt.Errorf("%q isn't a share of the pot", trimmed)
+		}
+		return num / den, true, nil
+	}
+
+	// Multiples like "2 pot"
+	if trimmed != size {
+		n, err := parseBetFloat(trimmed)
+		return n, true, err
+	}
+	return 0, false, nil
+}
+
+func parseBetNumber(s string) (int, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Didn't understand %q, try an amount %s", s, betSizeHelp)
+	}
+	return int(n), nil
+}
+
+func parseBetFloat(s string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Didn't understand %q, try an amount %s", s, betSizeHelp)
+	}
+	return n, nil
+}
+
+// Relative sizes can come out of range, explain instead of quietly going all in or raising the minimum
+func checkBetRange(what string, chips int, ctx *BetContext) (int, error) {
+	if chips > ctx.MaxRaise {
+		return 0, fmt.Errorf("%s but you can raise at most %d, use max to go all in", what, ctx.MaxRaise)
+	}
+	if chips < ctx.MinRaise {
+		return 0, fmt.Errorf("%s but the smallest raise is %d, use min for that", what, ctx.MinRaise)
+	}
+	return chips, nil
+}
+
+// Lets players write bet and raise interchangeably, returns the one that's valid
+func betOrRaise(action table.Action, valid []table.Action) (table.Action, bool) {
+	if action != table.Bet && action != table.Raise {
+		return action, false
+	}
+
+	other := table.Bet
+	if action == table.Bet {
+		other = table.Raise
+	}
+	for _, v := range valid {
+		if v == other {
+			return other, true
+		}
+	}
+	return action, false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveBet(t *testing.T) {
+	// Facing a bet of 10 into a pot of 30 with 5 already in
+	ctx := &BetContext{MinRaise: 10, MaxRaise: 200, Pot: 30, Outstanding: 5, CurrentBet: 10, BigBlind: 4}
+
+	cases := map[string]int{
+		"40":       40,
+		"to 60":    50,
+		"3bb":      12,
+		"3x":       20,
+		"pot":      35,
+		"half pot": 18,
+		"2/3":      23,
+		"100%":     35,
+		"min":      10,
+		"max":      200,
+		"All In":   200,
+	}
+	for size, expected := range cases {
+		chips, err := ResolveBet(size, ctx)
+		if err != nil {
+			t.Errorf("%q: %s", size, err)
+		} else if chips != expected {
+			t.Errorf("%q: expected %d, got %d", size, expected, chips)
+		}
+	}
+
+	errors := map[string]string{
+		"":       "specifying amount",
+		"lots":   "Didn't understand",
+		"1bb":    "smallest raise is 10",
+		"10 pot": "at most 200",
+		"0":      "less then 1",
+	}
+	for size, expected := range errors {
+		_, err := ResolveBet(size, ctx)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", size, expected, err)
+		}
+	}
+
+	// Nothing to multiply before anyone bet
+	_, err := ResolveBet("3x", &BetContext{MinRaise: 4, MaxRaise: 100, Pot: 8, BigBlind: 4})
+	if err == nil || !strings.Contains(err.Error(), "no bet to multiply") {
+		t.Errorf("Expected 3x without a bet to be explained, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BlindLevel struct {
+	Small   int
+	Big     int
+	Ante    int
+	Minutes int // Length of the level in minutes, 0 if it's measured in hands
+	Hands   int // Length of the level in hands, 0 if it's measured in minutes
+}
+
+func (l *BlindLevel) String() string {
+	out := fmt.Sprintf("%d/%d", l.Small, l.Big)
+	if l.Ante > 0 {
+		out += fmt.Sprintf(" ante %d", l.Ante)
+	}
+	return out
+}
+
+// A blind structure the table goes through, advanced between hands
+type BlindSchedule struct {
+	Name   string
+	Levels []*BlindLevel
+
+	Level        int           // Current level
+	LevelStarted time.Time     // When the current level started, adjusted for time the table was stopped
+	LevelHands   int           // Hands played at the current level
+	LevelElapsed time.Duration // Time spent on the current level when the table was last stopped
+}
+
+// Named schedules are multiples of the small blind the table had when it was set
+var blindPresets = map[string]struct {
+	Multipliers []int
+	Minutes     int
+}{
+	"standard": {Multipliers: []int{1, 2, 3, 4, 6, 8, 10, 15, 20, 30, 40, 60, 80, 100}, Minutes: 15},
+	"turbo":    {Multipliers: []int{1, 2, 3, 5, 8, 12, 20, 30, 50, 80, 100}, Minutes: 6},
+}
+
+// Parses either the name of a preset or a custom list of levels like "10/20@10m, 20/40/5@15h"
+// where m means the level lasts that many minutes and h that many hands
+func ParseBlindSchedule(str string, small int) (*BlindSchedule, error) {
+	str = strings.ToLower(strings.TrimSpace(str))
+	if small < 1 {
+		small = 1
+	}
+
+	if preset, ok := blindPresets[str]; ok {
+		schedule := &BlindSchedule{Name: str}
+		for k, v := range preset.Multipliers {
+			level := &BlindLevel{Small: small * v, Big: small * v * 2, Minutes: preset.Minutes}
+			// Antes kick in later
+			if k >= 4 {
+				level.Ante = level.Small / 4
+			}
+			schedule.Levels = append(schedule.Levels, level)
+		}
+		return schedule, nil
+	}
+
+	schedule := &BlindSchedule{Name: "custom"}
+	for _, levelStr := range strings.Split(str, ",") {
+		level, err := parseBlindLevel(strings.TrimSpace(levelStr))
+		if err != nil {
+			return nil, err
+		}
+		schedule.Levels = append(schedule.Levels, level)
+	}
+	return schedule, nil
+}
+
+var errBlindLevelFormat = errors.New("Blinds has to be standard, turbo, off or a list of levels like 10/20@10m, 20/40/5@15h (m for minutes, h for hands)")
+
+func parseBlindLevel(str string) (*BlindLevel, error) {
+	level := &BlindLevel{Minutes: 15}
+
+	split := strings.SplitN(str, "@", 2)
+	if len(split) > 1 {
+		durStr := strings.TrimSpace(split[1])
+		if len(durStr) < 2 {
+			return nil, errBlindLevelFormat
+		}
+
+		dur, err := strconv.Atoi(durStr[:len(durStr)-1])
+		if err != nil || dur < 1 {
+			return nil, errBlindLevelFormat
+		}
+
+		switch durStr[len(durStr)-1] {
+		case 'm':
+			level.Minutes = dur
+		case 'h':
+			level.Minutes = 0
+			level.Hands = dur
+		default:
+			return nil, errBlindLevelFormat
+		}
+	}
+
+	stakes := strings.Split(split[0], "/")
+	if len(stakes) < 2 || len(stakes) > 3 {
+		return nil, errBlindLevelFormat
+	}
+
+	parsed := make([]int, len(stakes))
+	for k, v := range stakes {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, errBlindLevelFormat
+		}
+		parsed[k] = n
+	}
+
+	level.Small = parsed[0]
+	level.Big = parsed[1]
+	if len(parsed) > 2 {
+		level.Ante = parsed[2]
+	}
+
+	if level.Small < 1 || level.Big < level.Small {
+		return nil, errors.New("Big blind can't be smaller than the small blind and blinds has to be atleast 1")
+	}
+	return level, nil
+}
+
+func (s *BlindSchedule) Current() *BlindLevel {
+	return s.Levels[s.Level]
+}
+
+func (s *BlindSchedule) IsLastLevel() bool {
+	return s.Level >= len(s.Levels)-1
+}
+
+// Returns true if the current level is over
+func (s *BlindSchedule) LevelOver() bool {
+	if s.IsLastLevel() {
+		return false
+	}
+
+	level := s.Current()
+	if level.Hands > 0 {
+		return s.LevelHands >= level.Hands
+	}
+	return s.elapsed() >= time.Duration(level.Minutes)*time.Minute
+}
+
+// Time spent on the current level, the clock is stopped while the table is
+func (s *BlindSchedule) elapsed() time.Duration {
+	if s.LevelStarted.IsZero() {
+		return s.LevelElapsed
+	}
+	return time.Since(s.LevelStarted)
+}
+
+// Returns a human readable time until the next level
+func (s *BlindSchedule) UntilNext() string {
+	if s.IsLastLevel() {
+		return "this is the last level"
+	}
+
+	level := s.Current()
+	if level.Hands > 0 {
+		return fmt.Sprintf("next level in %d hands", level.Hands-s.LevelHands)
+	}
+
+	left := time.Duration(level.Minutes)*time.Minute - s.elapsed()
+	if left < time.Minute {
+		return "next level after this hand"
+	}
+	return fmt.Sprintf("next level in %d minutes", int(left.Minutes()))
+}
+
+func (s *BlindSchedule) String() string {
+	levels := make([]string, len(s.Levels))
+	for k, v := range s.Levels {
+		levels[k] = v.String()
+		if k == s.Level {
+			levels[k] = "**" + levels[k] + "**"
+		}
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, strings.Join(levels, ", "))
+}
+
+// Applies the current blind level to the table
+func (t *Table) applyBlindLevel() {
+	level := t.Blinds.Current()
+
+	config := t.Table.Config()
+	config.Stakes.SmallBet = level.Small
+	config.Stakes.BigBet = level.Big
+	config.Stakes.Ante = level.Ante
+	t.Table.SetConfig(config)
+}
+
+// Called when the table starts running, continues the level clock where it left off
+func (t *Table) resumeBlinds() {
+	if t.Blinds == nil {
+		return
+	}
+
+	t.Blinds.LevelStarted = time.Now().Add(-t.Blinds.LevelElapsed)
+	t.applyBlindLevel()
+	t.Send(fmt.Sprintf("Blinds are **%s**, %s", t.Blinds.Current(), t.Blinds.UntilNext()))
+}
+
+// Called when the table stops, pauses the level clock
+func (t *Table) pauseBlinds() {
+	if t.Blinds == nil || t.Blinds.LevelStarted.IsZero() {
+		return
+	}
+	t.Blinds.LevelElapsed = time.Since(t.Blinds.LevelStarted)
+	t.Blinds.LevelStarted = time.Time{}
+}
+
+// Called between hands, moves on to the next level if the current one is over
+func (t *Table) advanceBlinds() {
+	if t.Blinds == nil {
+		return
+	}
+
+	t.Blinds.LevelHands++
+	if !t.Blinds.LevelOver() {
+		return
+	}
+
+	t.Blinds.Level++
+	t.Blinds.LevelHands = 0
+	t.Blinds.LevelElapsed = 0
+	t.Blinds.LevelStarted = time.Now()
+	t.applyBlindLevel()
+
+	t.Send(fmt.Sprintf("Blinds going up! Level %d: **%s**, %s", t.Blinds.Level+1, t.Blinds.Current(), t.Blinds.UntilNext()))
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"log"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Bot ids start with this so they can never be mistaken for a discord user
+const BotPrefix = "bot:"
+
+var botCounter int64
+
+func IsBot(id string) bool {
+	return strings.HasPrefix(id, BotPrefix)
+}
+
+// Returns the TablePlayer of a player at the table, bots have one too
+func asTablePlayer(p table.Player) *TablePlayer {
+	switch cast := p.(type) {
+	case *TablePlayer:
+		return cast
+	case *BotPlayer:
+		return cast.TablePlayer
+	}
+	panic("Failed casting to tableplayer??")
+}
+
+// What a bot knows when it's asked to act
+type BotState struct {
+	Game        table.Game
+	Hole        []*hand.Card
+	Board       []*hand.Card
+	Opponents   [][]*hand.Card // Face up cards of everyone else still in the hand
+	Valid       []table.Action
+	Outstanding int // Chips needed to call
+	Pot         int
+	MinRaise    int
+	MaxRaise    int
+	Chips       int
+	BigBlind    int
+	Rand        *rand.Rand
+}
+
+func (s *BotState) Can(action table.Action) bool {
+	for _, v := range s.Valid {
+		if v == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if possible, folds otherwise
+func (s *BotState) CheckFold() (table.Action, int) {
+	if s.Can(table.Check) {
+		return table.Check, 0
+	}
+	return table.Fold, 0
+}
+
+// Bets or raises the chips, clamped to what's allowed
+func (s *BotState) Raise(chips int) (table.Action, int) {
+	if chips < s.MinRaise {
+		chips = s.MinRaise
+	}
+	if chips > s.MaxRaise {
+		chips = s.MaxRaise
+	}
+
+	if s.Can(table.Raise) {
+		return table.Raise, chips
+	}
+	return table.Bet, chips
+}
+
+func (s *BotState) CanRaise() bool {
+	return (s.Can(table.Raise) || s.Can(table.Bet)) && s.MaxRaise > 0
+}
+
+// Share of the pot the hole cards are expected to win
+func (s *BotState) Equity(trials int) float64 {
+	return EstimateEquity(s.Game, s.Hole, s.Board, s.Opponents, trials, s.Rand)
+}
+
+// Share of the pot a player has to put in to call
+func (s *BotState) PotOdds() float64 {
+	if s.Outstanding < 1 {
+		return 0
+	}
+	return float64(s.Outstanding) / float64(s.Pot+s.Outstanding)
+}
+
+// BotStrategy decides what a bot does
+type BotStrategy interface {
+	Name() string
+	Decide(state *BotState) (table.Action, int)
+}
+
+// Anything goes, but never folds when it can check
+type RandomStrategy struct{}
+
+func (s RandomStrategy) Name() string { return "random" }
+
+func (s RandomStrategy) Decide(state *BotState) (table.Action, int) {
+	action := state.Valid[state.Rand.Intn(len(state.Valid))]
+	switch action {
+	case table.Fold:
+		return state.CheckFold()
+	case table.Bet, table.Raise:
+		if state.MaxRaise < 1 {
+			return state.CheckFold()
+		}
+		return state.Raise(state.MinRaise + state.Rand.Intn(state.MaxRaise-state.MinRaise+1))
+	}
+	return action, 0
+}
+
+// Only plays good hands and never bets them
+type TightPassiveStrategy struct{}
+
+func (s TightPassiveStrategy) Name() string { return "tight" }
+
+func (s TightPassiveStrategy) Decide(state *BotState) (table.Action, int) {
+	// Half again of what it would win with a random hand
+	fair := 1 / float64(len(state.Opponents)+1)
+	if state.Equity(200) < fair*1.5 {
+		return state.CheckFold()
+	}
+
+	if state.Can(table.Call) {
+		return table.Call, 0
+	}
+	return state.CheckFold()
+}
+
+// Raises when it's well ahead and calls when the pot odds are good enough
+type EquityStrategy struct{}
+
+func (s EquityStrategy) Name() string { return "equity" }
+
+func (s EquityStrategy) Decide(state *BotState) (table.Action, int) {
+	equity := state.Equity(500)
+	fair := 1 / float64(len(state.Opponents)+1)
+
+	if state.CanRaise() && equity >= fair+(1-fair)*0.35 {
+		return state.Raise(state.Pot * 2 / 3)
+	}
+
+	if state.Can(table.Call) && equity >= state.PotOdds() {
+		return table.Call, 0
+	}
+	return state.CheckFold()
+}
+
+// Difficulties that can be given to addbot
+var botStrategies = map[string]BotStrategy{
+	"random": RandomStrategy{},
+	"easy":   RandomStrategy{},
+
+	"tight":   TightPassiveStrategy{},
+	"passive": TightPassiveStrategy{},
+	"medium":  TightPassiveStrategy{},
+
+	"equity": EquityStrategy{},
+	"hard":   EquityStrategy{},
+}
+
+// Parses the difficulty, the tight strategy is used if it's empty
+func ParseBotStrategy(name string) (BotStrategy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return TightPassiveStrategy{}, nil
+	}
+
+	strategy, ok := botStrategies[name]
+	if !ok {
+		return nil, errors.New("Unknown difficulty, available: random (easy), tight (medium), equity (hard)")
+	}
+	return strategy, nil
+}
+
+// BotPlayer is a computer controlled player, it plays with house money so it never has a wallet
+type BotPlayer struct {
+	*TablePlayer
+	Strategy BotStrategy
+
+	rand *rand.Rand
+}
+
+func NewBotPlayer(tbl *Table, strategy BotStrategy) *BotPlayer {
+	n := atomic.AddInt64(&botCounter, 1)
+	return &BotPlayer{
+		TablePlayer: &TablePlayer{
+			Id:    fmt.Sprintf("%s%d", BotPrefix, n),
+			Name:  fmt.Sprintf("Bot %d (%s)", n, strategy.Name()),
+			Table: tbl,
+		},
+		Strategy: strategy,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano() + n)),
+	}
+}
+
+func (b *BotPlayer) FromID(id string) (table.Player, error) {
+	return &BotPlayer{TablePlayer: &TablePlayer{Id: id}, Strategy: b.Strategy}, nil
+}
+
+func (b *BotPlayer) Action() (table.Action, int) {
+	return b.recordAction(b.think)
+}
+
+func (b *BotPlayer) think() (table.Action, int) {
+	t := b.Table
+	t.UpdateView(fmt.Sprintf("**%s** is thinking", b.Name), nil, time.Time{})
+
+	// Give everyone a moment to see what happened
+	t.Unlock()
+	time.Sleep(t.Manager.botDelay())
+	t.Lock()
+
+	state := b.state()
+	if b.AutoFold || b.LeaveAfterFold {
+		action, chips := state.CheckFold()
+		if action == table.Fold {
+			b.foldedAndReadyToLeave = b.LeaveAfterFold
+		}
+		return action, chips
+	}
+
+	action, chips := b.Strategy.Decide(state)
+	if !state.Can(action) {
+		action, chips = state.CheckFold()
+	}
+
+	msg := fmt.Sprintf("**%s**: %s", b.Name, action)
+	if action == table.Bet || action == table.Raise {
+		msg += fmt.Sprintf(" %d", chips)
+	}
+	// The view shows it as the last action
+	if !t.viewing() {
+		t.Send(msg)
+	}
+	return action, chips
+}
+
+// Gathers what the bot can see, table should be locked
+func (b *BotPlayer) state() *BotState {
+	t := b.Table.Table
+	state := &BotState{
+		Game:        t.Game(),
+		Board:       t.Board(),
+		Valid:       t.ValidActions(),
+		Outstanding: t.Outstanding(),
+		Pot:         t.Pot().Chips(),
+		MinRaise:    t.MinRaise(),
+		MaxRaise:    t.MaxRaise(),
+		BigBlind:    t.Stakes().BigBet,
+		Rand:        b.rand,
+	}
+
+	for _, p := range t.Players() {
+		if p.Player().ID() == b.Id {
+			state.Chips = p.Chips()
+			for _, c := range p.HoleCards() {
+				state.Hole = append(state.Hole, c.Card)
+			}
+			continue
+		}
+
+		if p.Out() {
+			continue
+		}
+
+		showing := make([]*hand.Card, 0)
+		for _, c := range p.HoleCards() {
+			if c.Visibility == table.Exposed {
+				showing = append(showing, c.Card)
+			}
+		}
+		state.Opponents = append(state.Opponents, showing)
+	}
+	return state
+}
+
+// Seats a bot at the first free seat, it buys in with 100 big blinds of house money. Table should be locked
+func (t *Table) AddBot(strategy BotStrategy) (*BotPlayer, error) {
+	if t.IsTournament() {
+		return nil, errors.New("Bots can't play in tournaments")
+	}
+
+	bot := NewBotPlayer(t, strategy)
+	chips := t.Table.Stakes().BigBet * 100
+
+	players := t.Table.Players()
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		if _, ok := players[seat]; ok {
+			continue
+		}
+
+		err := t.Sit(bot, seat, chips)
+		if err != nil {
+			return nil, err
+		}
+		t.houseMoney(bot.Id, chips, ReasonHouseBuyIn)
+		return bot, nil
+	}
+	return nil, errors.New("No available seats")
+}
+
+// Makes all the bots leave, the ones in a hand leave after it. Table should be locked
+func (t *Table) RemoveBots() {
+	for _, p := range t.Table.Players() {
+		bot, ok := p.Player().(*BotPlayer)
+		if !ok {
+			continue
+		}
+
+		if t.inHand && !p.Out() {
+			bot.LeaveAfterFold = true
+			bot.AutoFold = true
+			continue
+		}
+
+		t.CashOut(p)
+		t.Send(bot.Name + " stood up")
+	}
+}
+
+// Returns the number of players at the table that aren't bots
+func (t *Table) Humans() int {
+	humans := 0
+	for _, p := range t.Table.Players() {
+		if !IsBot(p.Player().ID()) {
+			humans++
+		}
+	}
+	return humans
+}
+
+// Records house money brought to or taken from the table by a bot, it's never in anyones wallet
+func (t *Table) houseMoney(id string, delta int, reason string) {
+	err := playerManager.Ledger.Record(id, delta, t.MoneySource(reason))
+	if err != nil {
+		log.Printf("Failed recording house money for %s: %s", id, err)
+	}
+}
@@ -4,8 +4,51 @@ import (
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/dutil/commandsystem"
+	"github.com/jonas747/joker/table"
+	"regexp"
+	"strings"
 )
 
+var channelMentionRegex = regexp.MustCompile(`<#(\d+)>`)
+
+func HelpMessage(target string) string {
+	help := cmdSystem.GenerateHelp(target, 0)
+	return "**Help** - *(For problems/whatever contact jonas747#3124)*\n" + help + "\n" + VERSION
+}
+
+// Returns the money and stats of the user in the bank of the channel
+func StatsMessage(userID, name, channel string, filter *StatsFilter) string {
+	player := playerManager.GetCreatePlayer(userID, name)
+	bank := economies.BankFor(tableManager.Transport.GuildID(channel))
+
+	player.Lock()
+	stats := fmt.Sprintf("Stats for **%s**\n - Money: **$%d**\n", name, player.Balance(bank))
+	player.Unlock()
+
+	if filter.Game != "" || filter.Stakes != "" {
+		stats += fmt.Sprintf("In **%s**:\n", filter.String())
+	}
+	return stats + tableManager.HandLog.Stats.Get(userID, filter).String()
+}
+
+// Gives the user $50 in the bank of the channel if they have less than that
+func FreeMoney(userID, name, channel string) string {
+	player := playerManager.GetCreatePlayer(userID, name)
+	bank := economies.BankFor(tableManager.Transport.GuildID(channel))
+
+	player.Lock()
+	defer player.Unlock()
+	playerManager.EnsureWallet(player, bank)
+
+	if player.Balance(bank) >= 50 {
+		return "You have too much money already >:{"
+	}
+
+	player.addMoney(bank, 50)
+	playerManager.Commit(player, 50, MoneySource{Reason: ReasonFreeMoney, Channel: channel, Bank: bank})
+	return fmt.Sprintf("Stats for **%s**\n - Money: **$%d**", name, player.Balance(bank))
+}
+
 var Commands = []commandsystem.CommandHandler{
 	&commandsystem.SimpleCommand{
 		Name:        "Help",
@@ -18,8 +61,7 @@ var Commands = []commandsystem.CommandHandler{
 			if parsed.Args[0] != nil {
 				target = parsed.Args[0].Str()
 			}
-			help := cmdSystem.GenerateHelp(target, 0)
-			dgo.ChannelMessageSend(m.ChannelID, "**Help** - *(For problems/whatever contact jonas747#3124)*\n"+help+"\n"+VERSION)
+			tableManager.Send(m.ChannelID, HelpMessage(target))
 			return nil
 		},
 	},
@@ -28,14 +70,85 @@ var Commands = []commandsystem.CommandHandler{
 		Description: "Responds with bot invite link",
 		RunInDm:     true,
 		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
-			dgo.ChannelMessageSend(m.ChannelID, "You smell bad https://discordapp.com/oauth2/authorize?client_id=201163424485343232&scope=bot&permissions=101376")
+			tableManager.Send(m.ChannelID, "You smell bad https://discordapp.com/oauth2/authorize?client_id=201163424485343232&scope=bot&permissions=101376")
 			return nil
 		},
 	},
 	&commandsystem.SimpleCommand{
 		Name:        "Stats",
 		Aliases:     []string{"st"},
-		Description: "Shows stats for a user or yourself",
+		Description: "Shows stats for a user or yourself, optionally only for a game and/or stakes, e.g `stats @user holdem 10/20`",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Filters", Description: "Optionally a user, game and stakes", Type: commandsystem.ArgumentTypeString},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			user := m.Author
+			for _, mention := range m.Mentions {
+				if mention.ID != dgo.State.User.ID {
+					user = mention
+					break
+				}
+			}
+
+			filter := ParseStatsFilter(strings.Fields(m.Content))
+			tableManager.Send(m.ChannelID, StatsMessage(user.ID, user.Username, m.ChannelID, filter))
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "FreeMoney",
+		Aliases:     []string{"fm", "giefmoney", "gief", "mmm"},
+		Description: "Gives you $50 if you have less than that",
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			tableManager.Send(m.ChannelID, FreeMoney(m.Author.ID, m.Author.Username, m.ChannelID))
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Economy",
+		Description: "Shows or changes (admins only) whether this server uses the global bank or its own isolated one",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Mode", Description: "global or isolated", Type: commandsystem.ArgumentTypeString},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			guild := tableManager.Transport.GuildID(m.ChannelID)
+			if guild == "" {
+				tableManager.Send(m.ChannelID, "This only works in servers")
+				return nil
+			}
+
+			if parsed.Args[0] == nil {
+				tableManager.Send(m.ChannelID, "This server uses "+BankName(economies.BankFor(tableManager.Transport.GuildID(m.ChannelID))))
+				return nil
+			}
+
+			if !tableManager.Transport.IsAdmin(m.Author.ID, m.ChannelID) {
+				tableManager.Send(m.ChannelID, "Only server admins can change the economy")
+				return nil
+			}
+
+			isolated := false
+			switch strings.ToLower(parsed.Args[0].Str()) {
+			case "global", "shared":
+			case "isolated", "own", "server":
+				isolated = true
+			default:
+				tableManager.Send(m.ChannelID, "Economy has to be global or isolated")
+				return nil
+			}
+
+			err := economies.Set(guild, isolated)
+			if err != nil {
+				return err
+			}
+
+			tableManager.Send(m.ChannelID, "This server now uses "+BankName(economies.BankFor(tableManager.Transport.GuildID(m.ChannelID)))+", tables that are already running keep using the bank they were created with")
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Ledger",
+		Description: "Shows the most recent changes to a users or your own money",
 		Arguments: []*commandsystem.ArgumentDef{
 			&commandsystem.ArgumentDef{Name: "User", Description: "Optionally specify a user", Type: commandsystem.ArgumentTypeUser},
 		},
@@ -45,66 +158,332 @@ var Commands = []commandsystem.CommandHandler{
 				user = parsed.Args[0].DiscordUser()
 			}
 
-			player := playerManager.GetCreatePlayer(user.ID, user.Username)
+			entries, err := playerManager.Ledger.Recent(user.ID, 10)
+			if err != nil {
+				return err
+			}
 
-			player.Lock()
-			stats := fmt.Sprintf("Stats for **%s**\n - Money: **$%d**", user.Username, player.Money)
-			player.Unlock()
+			out := fmt.Sprintf("Recent ledger entries for **%s**\n", user.Username)
+			if len(entries) < 1 {
+				out += "Nothing recorded"
+			}
+			for _, entry := range entries {
+				out += " - " + entry.String() + "\n"
+			}
 
-			go SurelySend(m.ChannelID, stats)
+			tableManager.Send(m.ChannelID, out)
 			return nil
 		},
 	},
 	&commandsystem.SimpleCommand{
-		Name:        "FreeMoney",
-		Aliases:     []string{"fm", "giefmoney", "gief", "mmm"},
-		Description: "Gives you $50 if you have less than that",
+		Name:        "Leaderboard",
+		Aliases:     []string{"lb", "top"},
+		Description: "Ranks players by money, profit, hands or tournament winnings, on this server or globally",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Board", Description: "money, profit, hands or tournaments", Type: commandsystem.ArgumentTypeString},
+			&commandsystem.ArgumentDef{Name: "Scope", Description: "server or global", Type: commandsystem.ArgumentTypeString},
+			&commandsystem.ArgumentDef{Name: "Page", Description: "Page to show", Type: commandsystem.ArgumentTypeString},
+		},
 		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
-			player := playerManager.GetCreatePlayer(m.Author.ID, m.Author.Username)
+			args := make([]string, 0)
+			for _, arg := range parsed.Args {
+				if arg != nil {
+					args = append(args, arg.Str())
+				}
+			}
 
+			board, global, page, err := ParseLeaderboardArgs(args)
+			if err != nil {
+				tableManager.Send(m.ChannelID, err.Error())
+				return nil
+			}
+
+			guild := ""
+			bank := GlobalBank
+			scope := "global"
+			if !global {
+				guild = tableManager.Transport.GuildID(m.ChannelID)
+				bank = economies.BankFor(tableManager.Transport.GuildID(m.ChannelID))
+				if guild != "" {
+					scope = "this server"
+				}
+			}
+
+			tableManager.Send(m.ChannelID, FormatLeaderboard(scope, playerManager.Leaderboard(board, guild, bank, page, m.Author.ID)))
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "History",
+		Description: "DMs you your last hands in the PokerStars hand history format",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Hands", Description: "Number of hands, defaults to 5", Type: commandsystem.ArgumentTypeNumber},
+		},
+		RunInDm: true,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			n := 5
+			if parsed.Args[0] != nil {
+				n = parsed.Args[0].Int()
+			}
+			if n < 1 || n > 50 {
+				tableManager.Send(m.ChannelID, "Number of hands has to be between 1 and 50")
+				return nil
+			}
+
+			hands, err := tableManager.HandLog.Recent(m.Author.ID, n)
+			if err != nil {
+				return err
+			}
+
+			if len(hands) < 1 {
+				tableManager.Transport.SendPrivateMessage(m.Author.ID, "You haven't played any hands yet")
+				return nil
+			}
+
+			exported := make([]string, len(hands))
+			for k, h := range hands {
+				exported[k] = h.PokerStars(m.Author.ID)
+			}
+
+			go func() {
+				for _, msg := range SplitMessage(strings.Join(exported, "\n\n"), 1990) {
+					tableManager.Transport.SendPrivateMessage(m.Author.ID, "```\n"+msg+"```")
+				}
+			}()
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Replay",
+		Description: "Deals a hand again from its recorded deck and checks it paid out right (admins only)",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Hand", Description: "Id of the hand", Type: commandsystem.ArgumentTypeNumber},
+		},
+		RequiredArgs: 1,
+		RunInDm:      true,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			h, err := tableManager.HandLog.Get(int64(parsed.Args[0].Int()))
+			if err != nil {
+				return err
+			}
+			if h == nil {
+				tableManager.Send(m.ChannelID, "No hand with that id")
+				return nil
+			}
+
+			if m.Author.ID != flagOwner && !tableManager.Transport.IsAdmin(m.Author.ID, h.Channel) {
+				tableManager.Send(m.ChannelID, "Only admins of the server the hand was played in can replay it")
+				return nil
+			}
+
+			result, err := ReplayHand(h)
+			if err != nil {
+				tableManager.Send(m.ChannelID, "Failed replaying the hand: "+err.Error())
+				return nil
+			}
+
+			tableManager.Send(m.ChannelID, result.String())
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Verify",
+		Description: "Checks a provably fair hand was dealt from the seed it committed to and paid out right",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Hand", Description: "Id of the hand", Type: commandsystem.ArgumentTypeNumber},
+		},
+		RequiredArgs: 1,
+		RunInDm:      true,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			h, err := tableManager.HandLog.Get(int64(parsed.Args[0].Int()))
+			if err != nil {
+				return err
+			}
+			if h == nil {
+				tableManager.Send(m.ChannelID, "No hand with that id")
+				return nil
+			}
+
+			err = VerifyHand(h)
+			if err != nil {
+				tableManager.Send(m.ChannelID, fmt.Sprintf("Hand #%d failed verification: %s", h.ID, err))
+				return nil
+			}
+
+			tableManager.Send(m.ChannelID, fmt.Sprintf("Hand #%d is fair: the seed `%s` matches the hash `%s` published before the hand, the deck comes from it and %d pieces of player entropy, and replaying it pays out the same",
+				h.ID, h.Fair.ServerSeed, h.Fair.Commitment, len(h.Fair.Entropy)))
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Entropy",
+		Description: "Mixes your own randomness into the next deck at a provably fair table",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Text", Description: "Anything", Type: commandsystem.ArgumentTypeString},
+		},
+		RequiredArgs: 1,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			entropy := parsed.Args[0].Str()
+			if split := strings.SplitN(m.Content, " ", 2); len(split) > 1 {
+				entropy = strings.TrimSpace(split[1])
+			}
+
+			tableManager.EvtChan <- &EntropyEvt{
+				PlayerID: m.Author.ID,
+				Name:     m.Author.Username,
+				Channel:  m.ChannelID,
+				Entropy:  entropy,
+			}
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Odds",
+		Description: "Calculates the chances of holdem or omaha hands, like odds AhKh vs QsQd 2c7d9h",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Hands", Description: "Hands separated by vs, optionally followed by the board", Type: commandsystem.ArgumentTypeString},
+		},
+		RequiredArgs: 1,
+		RunInDm:      true,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			args := parsed.Args[0].Str()
+			if split := strings.SplitN(m.Content, " ", 2); len(split) > 1 {
+				args = split[1]
+			}
+
+			game, hands, board, err := ParseOdds(args)
+			if err != nil {
+				tableManager.Send(m.ChannelID, err.Error())
+				return nil
+			}
+
+			equities, exact, err := CalculateEquity(game, hands, board)
+			if err != nil {
+				tableManager.Send(m.ChannelID, err.Error())
+				return nil
+			}
+
+			labels := make([]string, len(hands))
+			for k, h := range hands {
+				labels[k] = cardsString(h)
+			}
+			out := formatEquities(game, labels, equities, exact)
+			if len(board) > 0 {
+				out = "Board " + cardsString(board) + "\n" + out
+			}
+			tableManager.Send(m.ChannelID, out)
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "Cards",
+		Description: "Shows or changes how your hand is shown to you: image, ascii, emoji or table to go with what the table uses",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Style", Description: "image, ascii, emoji or table", Type: commandsystem.ArgumentTypeString},
+		},
+		RunInDm: true,
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			player := playerManager.GetCreatePlayer(m.Author.ID, m.Author.Username)
 			player.Lock()
+			defer player.Unlock()
+
+			if parsed.Args[0] == nil {
+				style := player.CardStyle
+				if style == "" {
+					style = "whatever the table uses"
+				}
+				tableManager.Send(m.ChannelID, "Your cards are shown as "+style)
+				return nil
+			}
 
-			if player.Money < 50 {
-				player.Money += 50
-				stats := fmt.Sprintf("Stats for **%s**\n - Money: **$%d**", m.Author.Username, player.Money)
-				go SurelySend(m.ChannelID, stats)
+			style := strings.ToLower(parsed.Args[0].Str())
+			if style != "table" {
+				var err error
+				style, err = ParseCardStyle(style)
+				if err != nil {
+					tableManager.Send(m.ChannelID, err.Error())
+					return nil
+				}
 			} else {
-				go SurelySend(m.ChannelID, "You have too much money already >:{")
+				style = ""
 			}
 
-			player.Unlock()
+			player.CardStyle = style
+			playerManager.Save(player)
+			tableManager.Send(m.ChannelID, "Changed how your cards are shown, it's used from the next hand")
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "AddBot",
+		Description: "Seats a computer controlled player at your table, it plays with house money",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Difficulty", Description: "random (easy), tight (medium, the default) or equity (hard)", Type: commandsystem.ArgumentTypeString},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			difficulty := ""
+			if parsed.Args[0] != nil {
+				difficulty = parsed.Args[0].Str()
+			}
+
+			strategy, err := ParseBotStrategy(difficulty)
+			if err != nil {
+				tableManager.Send(m.ChannelID, err.Error())
+				return nil
+			}
 
+			tableManager.EvtChan <- &AddBotEvt{
+				PlayerID: m.Author.ID,
+				Channel:  m.ChannelID,
+				Strategy: strategy,
+			}
+			return nil
+		},
+	},
+	&commandsystem.SimpleCommand{
+		Name:        "RemoveBots",
+		Description: "Makes the bots at your table leave, the ones playing leave after the hand",
+		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+			tableManager.EvtChan <- &RemoveBotsEvt{
+				PlayerID: m.Author.ID,
+				Channel:  m.ChannelID,
+			}
 			return nil
 		},
 	},
 	&commandsystem.SimpleCommand{
 		Name:        "Create",
-		Aliases:     []string{"c"},
 		Description: "Creates a table",
 		Arguments: []*commandsystem.ArgumentDef{
 			&commandsystem.ArgumentDef{Name: "Buy in", Description: "Your buy in amount", Type: commandsystem.ArgumentTypeNumber},
 			&commandsystem.ArgumentDef{Name: "Stakes-small", Description: "Small stakes for this table", Type: commandsystem.ArgumentTypeNumber},
 			&commandsystem.ArgumentDef{Name: "Stakes-min", Description: "Big stakes for this table", Type: commandsystem.ArgumentTypeNumber},
+			&commandsystem.ArgumentDef{Name: "Game", Description: "Optionally specify the game: holdem, omaha, omahahilo, stud, studhilo or razz", Type: commandsystem.ArgumentTypeString},
 		},
 		RequiredArgs: 3,
 		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
-			privateChannel, err := GetCreatePrivateChannel(m.Author.ID)
-			if err != nil {
-				return err
-			}
-
 			buyin := parsed.Args[0].Int()
 			small := parsed.Args[1].Int()
 			big := parsed.Args[2].Int()
 
+			game := table.Holdem
+			if parsed.Args[3] != nil {
+				var err error
+				game, err = ParseGame(parsed.Args[3].Str())
+				if err != nil {
+					tableManager.Send(m.ChannelID, err.Error())
+					return nil
+				}
+			}
+
 			evt := &CreateTableEvt{
-				PlayerID:       m.Author.ID,
-				PrivateChannel: privateChannel,
-				Name:           m.Author.Username,
-				Channel:        m.ChannelID,
-				BuyIn:          buyin,
-				Small:          small,
-				Big:            big,
+				PlayerID: m.Author.ID,
+				Name:     m.Author.Username,
+				Channel:  m.ChannelID,
+				BuyIn:    buyin,
+				Small:    small,
+				Big:      big,
+				Game:     game,
 			}
 
 			tableManager.EvtChan <- evt
@@ -120,25 +499,139 @@ var Commands = []commandsystem.CommandHandler{
 		},
 		RequiredArgs: 1,
 		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
-			privateChannel, err := GetCreatePrivateChannel(m.Author.ID)
-			if err != nil {
-				return err
-			}
-
 			money := parsed.Args[0].Int()
 
 			evt := &AddPlayerEvt{
-				PlayerID:       m.Author.ID,
-				PrivateChannel: privateChannel,
-				Name:           m.Author.Username,
-				Channel:        m.ChannelID,
-				BuyIn:          money,
+				PlayerID: m.Author.ID,
+				Name:     m.Author.Username,
+				Channel:  m.ChannelID,
+				BuyIn:    money,
 			}
 
 			tableManager.EvtChan <- evt
 			return nil
 		},
 	},
+	&commandsystem.CommandContainer{
+		Name:        "Tournament",
+		Aliases:     []string{"tour", "sng"},
+		Description: "Sit and go tournaments",
+		Children: []commandsystem.CommandHandler{
+			&commandsystem.SimpleCommand{
+				Name:        "Create",
+				Aliases:     []string{"c"},
+				Description: "Creates a tournament table that starts when all seats are taken",
+				Arguments: []*commandsystem.ArgumentDef{
+					&commandsystem.ArgumentDef{Name: "Buy in", Description: "Buy in everyone pays", Type: commandsystem.ArgumentTypeNumber},
+					&commandsystem.ArgumentDef{Name: "Seats", Description: "Number of players", Type: commandsystem.ArgumentTypeNumber},
+				},
+				RequiredArgs: 2,
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &CreateTournamentEvt{
+						PlayerID: m.Author.ID,
+						Name:     m.Author.Username,
+						Channel:  m.ChannelID,
+						BuyIn:    parsed.Args[0].Int(),
+						Seats:    parsed.Args[1].Int(),
+					}
+					return nil
+				},
+			},
+			&commandsystem.SimpleCommand{
+				Name:        "Join",
+				Aliases:     []string{"j", "register"},
+				Description: "Registers for the tournament in this channel",
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &AddPlayerEvt{
+						PlayerID: m.Author.ID,
+						Name:     m.Author.Username,
+						Channel:  m.ChannelID,
+					}
+					return nil
+				},
+			},
+		},
+	},
+	&commandsystem.CommandContainer{
+		Name:        "MTT",
+		Aliases:     []string{"multitable"},
+		Description: "Multi table tournaments, the channel the tournament is created in is the lobby",
+		Children: []commandsystem.CommandHandler{
+			&commandsystem.SimpleCommand{
+				Name:        "Create",
+				Aliases:     []string{"c"},
+				Description: "Creates a tournament played in the mentioned channels, e.g `mtt create 100 #table-1 #table-2`",
+				Arguments: []*commandsystem.ArgumentDef{
+					&commandsystem.ArgumentDef{Name: "Buy in", Description: "Buy in everyone pays", Type: commandsystem.ArgumentTypeNumber},
+					&commandsystem.ArgumentDef{Name: "Channels", Description: "Channels to play in", Type: commandsystem.ArgumentTypeString},
+				},
+				RequiredArgs: 2,
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					channels := make([]string, 0)
+					for _, match := range channelMentionRegex.FindAllStringSubmatch(m.Content, -1) {
+						channels = append(channels, match[1])
+					}
+
+					tableManager.EvtChan <- &CreateMTTEvt{
+						PlayerID: m.Author.ID,
+						Name:     m.Author.Username,
+						Channel:  m.ChannelID,
+						BuyIn:    parsed.Args[0].Int(),
+						Channels: channels,
+					}
+					return nil
+				},
+			},
+			&commandsystem.SimpleCommand{
+				Name:        "Register",
+				Aliases:     []string{"r", "join"},
+				Description: "Registers for the tournament in this lobby",
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &MTTRegisterEvt{
+						PlayerID: m.Author.ID,
+						Name:     m.Author.Username,
+						Channel:  m.ChannelID,
+					}
+					return nil
+				},
+			},
+			&commandsystem.SimpleCommand{
+				Name:        "Unregister",
+				Aliases:     []string{"u"},
+				Description: "Unregisters from the tournament before it starts and refunds the buy in",
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &MTTRegisterEvt{
+						PlayerID:   m.Author.ID,
+						Name:       m.Author.Username,
+						Channel:    m.ChannelID,
+						Unregister: true,
+					}
+					return nil
+				},
+			},
+			&commandsystem.SimpleCommand{
+				Name:        "Start",
+				Aliases:     []string{"s"},
+				Description: "Starts the tournament, only the creator can do this",
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &MTTStartEvt{
+						PlayerID: m.Author.ID,
+						Channel:  m.ChannelID,
+					}
+					return nil
+				},
+			},
+			&commandsystem.SimpleCommand{
+				Name:        "Info",
+				Aliases:     []string{"i"},
+				Description: "Shows the status of the tournament",
+				RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
+					tableManager.EvtChan <- &MTTInfoEvt{Channel: m.ChannelID}
+					return nil
+				},
+			},
+		},
+	},
 	&commandsystem.SimpleCommand{
 		Name:        "Start",
 		Aliases:     []string{"s"},
@@ -174,8 +667,11 @@ var Commands = []commandsystem.CommandHandler{
 		},
 	},
 	&commandsystem.SimpleCommand{
-		Name:         "Ban",
-		Description:  "Bans a player from your table >:O",
+		Name:        "Ban",
+		Description: "Bans a player from your table >:O",
+		Arguments: []*commandsystem.ArgumentDef{
+			&commandsystem.ArgumentDef{Name: "Target", Description: "Player to ban", Type: commandsystem.ArgumentTypeUser},
+		},
 		RequiredArgs: 1,
 		RunFunc: func(parsed *commandsystem.ParsedCommand, m *discordgo.MessageCreate) error {
 			target := parsed.Args[0].DiscordUser()
@@ -227,22 +723,3 @@ var Commands = []commandsystem.CommandHandler{
 		},
 	},
 }
-
-func GetCreatePrivateChannel(userID string) (string, error) {
-	dgo.State.RLock()
-	for _, channel := range dgo.State.PrivateChannels {
-		if channel.Recipient.ID == userID {
-			dgo.State.RUnlock()
-			return channel.ID, nil
-		}
-	}
-	dgo.State.RUnlock()
-
-	channel, err := dgo.UserChannelCreate(userID)
-	if err != nil {
-		return "", err
-	}
-
-	go dgo.State.ChannelAdd(channel)
-	return channel.ID, nil
-}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"github.com/jonas747/joker/hand"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A dealer that remembers the deck it dealt last, so the hand can be recorded and replayed
+type RecordingDealer interface {
+	hand.Dealer
+
+	// Last returns the seed and the deck of the last hand, seed is 0 if the deck wasn't shuffled from one
+	Last() (seed int64, deck []*hand.Card)
+}
+
+// SeededDealer shuffles every deck from a new random seed, the same seed always gives the same deck
+type SeededDealer struct {
+	sync.Mutex
+	seeds *rand.Rand
+
+	lastSeed int64
+	lastDeck []*hand.Card
+}
+
+func NewSeededDealer() *SeededDealer {
+	return &SeededDealer{seeds: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (d *SeededDealer) Deck() *hand.Deck {
+	d.Lock()
+	defer d.Unlock()
+
+	d.lastSeed = d.seeds.Int63()
+	d.lastDeck = ShuffledDeck(d.lastSeed)
+
+	cards := make([]*hand.Card, len(d.lastDeck))
+	copy(cards, d.lastDeck)
+	return &hand.Deck{Cards: cards}
+}
+
+func (d *SeededDealer) Last() (int64, []*hand.Card) {
+	d.Lock()
+	defer d.Unlock()
+	return d.lastSeed, d.lastDeck
+}
+
+// Returns the deck shuffled from the seed
+func ShuffledDeck(seed int64) []*hand.Card {
+	cards := hand.Cards()
+	shuffled := make([]*hand.Card, len(cards))
+	for k, v := range rand.New(rand.NewSource(seed)).Perm(len(cards)) {
+		shuffled[k] = cards[v]
+	}
+	return shuffled
+}
+
+// StackedDealer deals the same deck every hand, the cards given first and then the rest of the deck in order.
+// Used to make hands reproducible
+type StackedDealer struct {
+	Cards []*hand.Card
+}
+
+func NewStackedDealer(cards []*hand.Card) *StackedDealer {
+	deck := make([]*hand.Card, 0, 52)
+	deck = append(deck, cards...)
+	for _, c := range hand.Cards() {
+		if !containsCard(cards, c) {
+			deck = append(deck, c)
+		}
+	}
+	return &StackedDealer{Cards: deck}
+}
+
+func (d *StackedDealer) Deck() *hand.Deck {
+	cards := make([]*hand.Card, len(d.Cards))
+	copy(cards, d.Cards)
+	return &hand.Deck{Cards: cards}
+}
+
+func (d *StackedDealer) Last() (int64, []*hand.Card) {
+	return 0, d.Cards
+}
+
+func containsCard(cards []*hand.Card, c *hand.Card) bool {
+	for _, v := range cards {
+		if v.String() == c.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses cards like "As Kd Th 10c" or "AsKd", suits can also be the symbols
+func ParseCards(cards string) ([]*hand.Card, error) {
+	out := make([]*hand.Card, 0)
+	for _, field := range strings.Fields(cards) {
+		// Emoji keyboards like to add a variation selector after the suit
+		normalized := strings.Replace(field, "\ufe0f", "", -1)
+		runes := []rune(strings.Replace(normalized, "10", "T", -1))
+		if len(runes) < 2 || len(runes)%2 != 0 {
+			return nil, errors.New("Invalid card " + field)
+		}
+
+		for i := 0; i < len(runes); i += 2 {
+			card := parseCard(string(runes[i]), string(runes[i+1]))
+			if card == nil {
+				return nil, errors.New("Invalid card " + field)
+			}
+			out = append(out, card)
+		}
+	}
+	return out, nil
+}
+
+func parseCard(rank, suit string) *hand.Card {
+	for symbol, letter := range psSuits {
+		if suit == string(symbol) {
+			suit = letter
+		}
+	}
+	normalized := strings.ToUpper(rank) + strings.ToLower(suit)
+
+	for _, c := range hand.Cards() {
+		if psCard(c) == normalized {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"sync"
+)
+
+// DiscordTransport is the transport for playing on discord, controls are reactions on the message
+type DiscordTransport struct {
+	Session *discordgo.Session
+	Outbox  *Outbox // Everything sent goes through this so it arrives in order
+
+	controlsLock sync.Mutex
+	controls     map[string]*sentControls // The last controls sent, by channel
+}
+
+type sentControls struct {
+	MessageID string
+	Controls  []*Control
+
+	added map[string]bool // Reactions already on the message, views keep theirs when the controls change
+}
+
+func (d *DiscordTransport) SendMessage(channel, msg string) {
+	d.Outbox.Queue(&outMessage{Channel: channel, Send: &discordgo.MessageSend{Content: msg}})
+}
+
+func (d *DiscordTransport) SendPrivateMessage(userID, msg string) {
+	d.Outbox.Queue(&outMessage{UserID: userID, Send: &discordgo.MessageSend{Content: msg}})
+}
+
+func pngMessage(msg, name string, data []byte) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: msg,
+		Files:   []*discordgo.File{{Name: name, ContentType: "image/png", Reader: bytes.NewReader(data)}},
+	}
+}
+
+func (d *DiscordTransport) SendFile(channel, msg, name string, data []byte) {
+	d.Outbox.Queue(&outMessage{Channel: channel, Send: pngMessage(msg, name, data)})
+}
+
+func (d *DiscordTransport) SendPrivateFile(userID, msg, name string, data []byte) {
+	d.Outbox.Queue(&outMessage{UserID: userID, Send: pngMessage(msg, name, data)})
+}
+
+func (d *DiscordTransport) SendControls(channel, msg string, controls []*Control) {
+	d.Outbox.Queue(&outMessage{
+		Channel: channel,
+		Send:    &discordgo.MessageSend{Content: msg},
+		Done: func(m *discordgo.Message, err error) {
+			if err == nil {
+				d.setControls(channel, m.ID, controls)
+			}
+		},
+	})
+}
+
+// Waits for the view to be sent since the id is needed to edit it
+func (d *DiscordTransport) SendView(channel string, view *View, controls []*Control) string {
+	done := make(chan string, 1)
+	d.Outbox.Queue(&outMessage{
+		Channel: channel,
+		Send:    &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{discordEmbed(view)}},
+		Done: func(m *discordgo.Message, err error) {
+			if err != nil {
+				done <- ""
+				return
+			}
+			d.setControls(channel, m.ID, controls)
+			done <- m.ID
+		},
+	})
+	return <-done
+}
+
+// Waits for the edit to go through, so views that change faster than they can be edited skip the states in between
+func (d *DiscordTransport) EditView(channel, viewID string, view *View, controls []*Control) {
+	done := make(chan bool, 1)
+	d.Outbox.Queue(&outMessage{
+		Channel: channel,
+		Edit:    &discordgo.MessageEdit{ID: viewID, Channel: channel, Embeds: &[]*discordgo.MessageEmbed{discordEmbed(view)}},
+		Done: func(m *discordgo.Message, err error) {
+			if err == nil {
+				d.setControls(channel, viewID, controls)
+			}
+			done <- true
+		},
+	})
+	<-done
+}
+
+func discordEmbed(view *View) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       view.Title,
+		Description: view.Description,
+		Color:       0x1e6b35,
+	}
+	if !view.Deadline.IsZero() {
+		// Discord counts this down by itself
+		embed.Description += fmt.Sprintf("\nTime left: <t:%d:R>", view.Deadline.Unix())
+	}
+	for _, f := range view.Fields {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: f.Name, Value: f.Value})
+	}
+	if view.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: view.Footer}
+	}
+	return embed
+}
+
+// Makes the controls the ones that can be pressed in the channel and adds the reactions the message doesn't have yet
+// in the background
+func (d *DiscordTransport) setControls(channel, messageID string, controls []*Control) {
+	d.controlsLock.Lock()
+	if d.controls == nil {
+		d.controls = make(map[string]*sentControls)
+	}
+	sent := &sentControls{MessageID: messageID, Controls: controls, added: make(map[string]bool)}
+	if last, ok := d.controls[channel]; ok && last.MessageID == messageID {
+		sent.added = last.added
+	}
+	d.controls[channel] = sent
+	d.controlsLock.Unlock()
+
+	go d.addReactions(channel, sent)
+}
+
+func (d *DiscordTransport) addReactions(channel string, sent *sentControls) {
+	messageID := sent.MessageID
+	for _, c := range sent.Controls {
+		d.controlsLock.Lock()
+		// No point adding the rest once the next controls are out
+		replaced := d.controls[channel] != sent
+		added := sent.added[c.Emoji]
+		if !replaced {
+			sent.added[c.Emoji] = true
+		}
+		d.controlsLock.Unlock()
+		if replaced {
+			return
+		}
+		if added {
+			continue
+		}
+
+		err := d.Session.MessageReactionAdd(channel, messageID, c.Emoji)
+		if err != nil {
+			log.Println("Failed adding control:", err)
+			return
+		}
+	}
+}
+
+// Returns the control with the emoji if the message has the last controls sent in the channel, any control if emoji
+// is empty. Nil if the controls were replaced
+func (d *DiscordTransport) pressed(channel, messageID, emoji string) *Control {
+	d.controlsLock.Lock()
+	defer d.controlsLock.Unlock()
+
+	sent, ok := d.controls[channel]
+	if !ok || sent.MessageID != messageID {
+		return nil
+	}
+	for _, c := range sent.Controls {
+		if emoji == "" || c.Emoji == emoji {
+			return c
+		}
+	}
+	return nil
+}
+
+func (d *DiscordTransport) UserName(userID string) string {
+	user, err := d.Session.User(userID)
+	if err != nil {
+		return userID
+	}
+	return user.Username
+}
+
+// Returns the guild the channel belongs to, empty for private channels or if it's unknown
+func (d *DiscordTransport) GuildID(channel string) string {
+	c, err := d.Session.State.Channel(channel)
+	if err != nil {
+		return ""
+	}
+	return c.GuildID
+}
+
+func (d *DiscordTransport) IsAdmin(userID, channel string) bool {
+	perms, err := d.Session.State.UserChannelPermissions(userID, channel)
+	if err != nil {
+		log.Println("Failed checking permissions:", err)
+		return false
+	}
+	return perms&discordgo.PermissionManageServer != 0
+}
+
+func (d *DiscordTransport) Run(handler func(m *IncomingMessage)) error {
+	d.Session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		handler(&IncomingMessage{
+			ChannelID:  m.ChannelID,
+			AuthorID:   m.Author.ID,
+			AuthorName: m.Author.Username,
+			Content:    m.Content,
+		})
+	})
+
+	d.Session.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		if s.State.User != nil && r.UserID == s.State.User.ID {
+			return
+		}
+
+		control := d.pressed(r.ChannelID, r.MessageID, r.Emoji.Name)
+		if control == nil {
+			return
+		}
+
+		// Take the reaction away so it can be pressed again, needs manage messages so it's fine if it fails
+		go s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID)
+
+		handler(&IncomingMessage{
+			ChannelID:  r.ChannelID,
+			AuthorID:   r.UserID,
+			AuthorName: d.UserName(r.UserID),
+			Content:    control.Command,
+		})
+	})
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// The bank shared by every guild that doesn't have its own economy, balances from before
+// guilds could have their own economy are in here
+const GlobalBank = ""
+
+// Economies keeps track of which guilds have an isolated economy, guild admins choose with the Economy command.
+// A guild with an isolated economy has its own bank where balances and free money are separate from everyone else
+type Economies struct {
+	sync.RWMutex
+	Path     string
+	Isolated map[string]bool
+}
+
+func LoadEconomies(path string) (*Economies, error) {
+	e := &Economies{Path: path, Isolated: make(map[string]bool)}
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return e, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(file, &e.Isolated)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Economies) IsIsolated(guild string) bool {
+	if e == nil {
+		return false
+	}
+
+	e.RLock()
+	defer e.RUnlock()
+	return e.Isolated[guild]
+}
+
+// Changes the economy of the guild and saves it
+func (e *Economies) Set(guild string, isolated bool) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if isolated {
+		e.Isolated[guild] = true
+	} else {
+		delete(e.Isolated, guild)
+	}
+
+	out, err := json.Marshal(e.Isolated)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := e.Path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, out, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, e.Path)
+}
+
+// Returns the bank used in the guild, the guild id for isolated economies or GlobalBank
+func (e *Economies) BankFor(guild string) string {
+	if e == nil {
+		return GlobalBank
+	}
+
+	if guild != "" && e.IsIsolated(guild) {
+		return guild
+	}
+	return GlobalBank
+}
+
+// Returns a human readable name of the bank
+func BankName(bank string) string {
+	if bank == GlobalBank {
+		return "the global bank"
+	}
+	return "this server's bank"
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MaxEnumeratedRunOuts = 20000 // Run outs are enumerated if there are at most this many, otherwise they're sampled
+	EquitySamples        = 10000
+)
+
+// How a hand does over all the ways the rest of the cards can come
+type Equity struct {
+	Win   float64 // Share of the run outs the hand wins alone
+	Tie   float64 // Share of the run outs the hand ties for the best
+	Share float64 // Share of the pot it wins on average, ties are split
+}
+
+// Number of cards a player ends up with and the size of the board
+func gameCards(game table.Game) (hole, board int) {
+	switch game {
+	case table.OmahaHi, table.OmahaHiLo:
+		return 4, 5
+	case table.StudHi, table.StudHiLo, table.Razz:
+		return 7, 0
+	}
+	return 2, 5
+}
+
+// Returns the best hand the player can make, in omaha that's exactly 2 hole cards and 3 from the board
+func bestHand(game table.Game, hole, board []*hand.Card) *hand.Hand {
+	if game != table.OmahaHi && game != table.OmahaHiLo {
+		cards := make([]*hand.Card, 0, len(hole)+len(board))
+		cards = append(cards, hole...)
+		return hand.New(append(cards, board...))
+	}
+
+	var best *hand.Hand
+	for _, h := range combinations(hole, 2) {
+		for _, b := range combinations(board, 3) {
+			current := hand.New(append(h, b...))
+			if best == nil || current.CompareTo(best) > 0 {
+				best = current
+			}
+		}
+	}
+	return best
+}
+
+// A hand ready to be compared, razz hands are ace to five lows where lower is better
+type scoredHand struct {
+	high *hand.Hand
+	low  []int
+}
+
+func scoreHand(game table.Game, hole, board []*hand.Card) *scoredHand {
+	if game == table.Razz {
+		cards := make([]*hand.Card, 0, len(hole)+len(board))
+		cards = append(cards, hole...)
+		return &scoredHand{low: bestLow(append(cards, board...))}
+	}
+	return &scoredHand{high: bestHand(game, hole, board)}
+}
+
+// Compares the hands the way the game is won, above 0 if a wins. Only the high half counts in hi-lo games
+func compareHands(a, b *scoredHand) int {
+	if a.low != nil {
+		return compareLows(b.low, a.low)
+	}
+	return a.high.CompareTo(b.high)
+}
+
+// Returns the best ace to five low of any 5 of the cards, aces are low and straights and flushes don't count
+func bestLow(cards []*hand.Card) []int {
+	var best []int
+	for _, combo := range combinations(cards, 5) {
+		if current := lowValue(combo); best == nil || compareLows(current, best) < 0 {
+			best = current
+		}
+	}
+	return best
+}
+
+// Scores 5 cards as a low, unpaired hands beat a pair which beats two pair and so on. After that the highest
+// ranks are compared first, pairs before kickers
+func lowValue(cards []*hand.Card) []int {
+	counts := make(map[int]int)
+	for _, c := range cards {
+		counts[strings.IndexByte(glyphRanks, psCard(c)[0])+1]++
+	}
+
+	ranks := make([]int, 0, len(counts))
+	for rank := range counts {
+		ranks = append(ranks, rank)
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if counts[ranks[i]] != counts[ranks[j]] {
+			return counts[ranks[i]] > counts[ranks[j]]
+		}
+		return ranks[i] > ranks[j]
+	})
+
+	// No pair, pair, two pair, trips, full house and quads
+	category := 0
+	switch most := counts[ranks[0]]; {
+	case most == 2 && len(ranks) == 4:
+		category = 1
+	case most == 2:
+		category = 2
+	case most == 3 && len(ranks) == 3:
+		category = 3
+	case most == 3:
+		category = 4
+	case most == 4:
+		category = 5
+	}
+	return append([]int{category}, ranks...)
+}
+
+// Below 0 if a is the better low
+func compareLows(a, b []int) int {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] - b[k]
+		}
+	}
+	return len(a) - len(b)
+}
+
+// Returns all the ways to pick n of the cards
+func combinations(cards []*hand.Card, n int) [][]*hand.Card {
+	if n == 0 {
+		return [][]*hand.Card{{}}
+	}
+	if len(cards) < n {
+		return nil
+	}
+
+	out := make([][]*hand.Card, 0)
+	for _, rest := range combinations(cards[1:], n-1) {
+		combo := make([]*hand.Card, 0, n)
+		combo = append(combo, cards[0])
+		out = append(out, append(combo, rest...))
+	}
+	return append(out, combinations(cards[1:], n)...)
+}
+
+// Deals out the missing cards of the hands and the board and keeps score
+type equityCalc struct {
+	game      table.Game
+	hands     [][]*hand.Card
+	board     []*hand.Card
+	holeSize  int
+	boardSize int
+
+	deck   []*hand.Card // Cards nobody has
+	needed int          // Cards dealt every run out
+
+	equities []*Equity
+	runOuts  int
+}
+
+func newEquityCalc(game table.Game, hands [][]*hand.Card, board []*hand.Card) (*equityCalc, error) {
+	holeSize, boardSize := gameCards(game)
+	if len(board) > boardSize {
+		return nil, fmt.Errorf("The board can have at most %d cards", boardSize)
+	}
+
+	known := make(map[string]bool)
+	addKnown := func(cards []*hand.Card) error {
+		for _, c := range cards {
+			if known[c.String()] {
+				return errors.New(c.String() + " is used twice")
+			}
+			known[c.String()] = true
+		}
+		return nil
+	}
+
+	c := &equityCalc{game: game, hands: hands, board: board, holeSize: holeSize, boardSize: boardSize}
+	c.needed = boardSize - len(board)
+	err := addKnown(board)
+	if err != nil {
+		return nil, err
+	}
+	for _, cards := range hands {
+		if len(cards) > holeSize {
+			return nil, fmt.Errorf("Hands can have at most %d cards", holeSize)
+		}
+		err = addKnown(cards)
+		if err != nil {
+			return nil, err
+		}
+		c.needed += holeSize - len(cards)
+	}
+
+	for _, card := range hand.Cards() {
+		if !known[card.String()] {
+			c.deck = append(c.deck, card)
+		}
+	}
+	if c.needed > len(c.deck) {
+		return nil, errors.New("Not enough cards in the deck")
+	}
+
+	c.equities = make([]*Equity, len(hands))
+	for k := range c.equities {
+		c.equities[k] = &Equity{}
+	}
+	return c, nil
+}
+
+// Number of run outs if every order the missing cards can come in is dealt
+func (c *equityCalc) orderedRunOuts() int {
+	runOuts := 1
+	for i := 0; i < c.needed; i++ {
+		runOuts *= len(c.deck) - i
+		if runOuts > MaxEnumeratedRunOuts {
+			return runOuts
+		}
+	}
+	return runOuts
+}
+
+// Scores one run out, dealt are the missing cards, board first and then every hand in order
+func (c *equityCalc) score(dealt []*hand.Card) {
+	deal := func(cards []*hand.Card, size int) []*hand.Card {
+		out := make([]*hand.Card, 0, size)
+		out = append(out, cards...)
+		for len(out) < size {
+			out = append(out, dealt[0])
+			dealt = dealt[1:]
+		}
+		return out
+	}
+
+	board := deal(c.board, c.boardSize)
+	best := make([]int, 0, len(c.hands))
+	var bestHandSoFar *scoredHand
+	for k, cards := range c.hands {
+		current := scoreHand(c.game, deal(cards, c.holeSize), board)
+		cmp := 1
+		if bestHandSoFar != nil {
+			cmp = compareHands(current, bestHandSoFar)
+		}
+
+		if cmp > 0 {
+			best = append(best[:0], k)
+			bestHandSoFar = current
+		} else if cmp == 0 {
+			best = append(best, k)
+		}
+	}
+
+	for _, k := range best {
+		if len(best) == 1 {
+			c.equities[k].Win++
+		} else {
+			c.equities[k].Tie++
+		}
+		c.equities[k].Share += 1 / float64(len(best))
+	}
+	c.runOuts++
+}
+
+// Deals every order the missing cards can come in, it's the same as every combination just counted more times
+func (c *equityCalc) enumerate() {
+	used := make([]bool, len(c.deck))
+	dealt := make([]*hand.Card, c.needed)
+
+	var next func(depth int)
+	next = func(depth int) {
+		if depth == c.needed {
+			c.score(dealt)
+			return
+		}
+
+		for k, card := range c.deck {
+			if used[k] {
+				continue
+			}
+			used[k] = true
+			dealt[depth] = card
+			next(depth + 1)
+			used[k] = false
+		}
+	}
+	next(0)
+}
+
+func (c *equityCalc) sample(trials int, r *rand.Rand) {
+	for i := 0; i < trials; i++ {
+		// Only shuffle as much of the deck as is dealt
+		for k := 0; k < c.needed; k++ {
+			j := k + r.Intn(len(c.deck)-k)
+			c.deck[k], c.deck[j] = c.deck[j], c.deck[k]
+		}
+		c.score(c.deck[:c.needed])
+	}
+}
+
+func (c *equityCalc) result() []*Equity {
+	for _, e := range c.equities {
+		e.Win /= float64(c.runOuts)
+		e.Tie /= float64(c.runOuts)
+		e.Share /= float64(c.runOuts)
+	}
+	return c.equities
+}
+
+// CalculateEquity returns the equity of each hand, hands and the board can be missing cards which are dealt from
+// what's left of the deck. Every run out is dealt if there are few enough, exact is false if they were sampled
+func CalculateEquity(game table.Game, hands [][]*hand.Card, board []*hand.Card) (equities []*Equity, exact bool, err error) {
+	c, err := newEquityCalc(game, hands, board)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.orderedRunOuts() <= MaxEnumeratedRunOuts {
+		c.enumerate()
+		return c.result(), true, nil
+	}
+
+	c.sample(EquitySamples, rand.New(rand.NewSource(time.Now().UnixNano())))
+	return c.result(), false, nil
+}
+
+// EstimateEquity samples trials run outs against the opponents and returns the share of the pot the hole cards
+// win on average. Opponents are the cards known of every opponent still in the hand, empty if nothing is known
+func EstimateEquity(game table.Game, hole, board []*hand.Card, opponents [][]*hand.Card, trials int, r *rand.Rand) float64 {
+	if trials < 1 || len(opponents) < 1 {
+		return 1
+	}
+
+	hands := append([][]*hand.Card{hole}, opponents...)
+	c, err := newEquityCalc(game, hands, board)
+	if err != nil {
+		return 0
+	}
+	c.sample(trials, r)
+	return c.result()[0].Share
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"math"
+	"testing"
+)
+
+func TestEquity(t *testing.T) {
+	game, hands, board, err := ParseOdds("AhAd vs KhKd 2c7d9s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game != table.Holdem || len(hands) != 2 || len(board) != 3 {
+		t.Fatalf("Expected 2 holdem hands and a flop, got %s %v %v", game, hands, board)
+	}
+
+	equities, exact, err := CalculateEquity(game, hands, board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exact {
+		t.Error("Expected the turn and river to be enumerated")
+	}
+	if equities[0].Win < 0.9 || math.Abs(equities[0].Win+equities[1].Win+equities[0].Tie-1) > 0.0001 {
+		t.Errorf("Expected aces to be a big favourite, got %+v and %+v", equities[0], equities[1])
+	}
+
+	// Preflop there are too many run outs, so they're sampled
+	_, hands, _, _ = ParseOdds("AhKh vs 2c2d")
+	equities, exact, err = CalculateEquity(game, hands, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exact {
+		t.Error("Expected preflop run outs to be sampled")
+	}
+	if math.Abs(equities[0].Share+equities[1].Share-1) > 0.0001 {
+		t.Errorf("Expected the shares to add up to the pot, got %+v and %+v", equities[0], equities[1])
+	}
+
+	for _, invalid := range []string{"AhKh", "AhKh vs", "AhKh vs AhQd", "AhKh vs QsQdJc", "AhKh vs 2c2d 3c4c5c6c7c8c"} {
+		if _, hands, board, err := ParseOdds(invalid); err == nil {
+			if _, _, err = CalculateEquity(table.Holdem, hands, board); err == nil {
+				t.Errorf("Expected %q to be invalid", invalid)
+			}
+		}
+	}
+}
+
+func TestRazzLow(t *testing.T) {
+	// A wheel is the best low, a pair loses to any unpaired hand
+	for _, v := range [][]string{{"Ah2c3d4s5hKcKd", "6h4c3c2dAsQsQh"}, {"KsQsJsTs9s8c7c", "AhAd2c2d3h3s4c"}} {
+		hands := make([][]*hand.Card, 0)
+		for _, str := range v {
+			cards, err := ParseCards(str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hands = append(hands, cards)
+		}
+
+		equities, _, err := CalculateEquity(table.Razz, hands, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equities[0].Win != 1 {
+			t.Errorf("Expected %s to beat %s, got %+v", v[0], v[1], equities[0])
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"strings"
+	"sync"
+)
+
+const (
+	MaxEntropyLength  = 100 // Characters in one contribution
+	MaxEntropyPerHand = 20
+)
+
+// What's needed to check a provably fair hand
+type FairProof struct {
+	Commitment string   // Hex encoded sha256 of the ServerSeed string, published before the hand
+	ServerSeed string   // Hex encoded, revealed after the hand
+	Entropy    []string `json:",omitempty"` // Contributed by players before the hand
+}
+
+// FairDealer shuffles with commit-reveal so players can check the deck wasn't picked after the fact.
+// The hash of the server seed is published before the hand, players can add their own entropy
+// and the seed is revealed after the hand so anyone can derive the deck again with FairDeck
+type FairDealer struct {
+	sync.Mutex
+
+	next    string   // Server seed for the next hand
+	entropy []string // Entropy for the next hand
+	open    bool     // The commitment was published and the deck isn't dealt yet, only then is entropy taken
+
+	lastProof *FairProof
+	lastDeck  []*hand.Card
+}
+
+func NewFairDealer() *FairDealer {
+	d := &FairDealer{}
+	d.newSeed()
+	return d
+}
+
+func (d *FairDealer) newSeed() {
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		panic(err)
+	}
+	d.next = hex.EncodeToString(seed)
+	d.entropy = nil
+}
+
+func hashSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the hash of the seed the next hand will be dealt from to publish, entropy is taken from now until the
+// deck is dealt
+func (d *FairDealer) Announce() string {
+	d.Lock()
+	defer d.Unlock()
+	d.open = true
+	return hashSeed(d.next)
+}
+
+// Returns true if the commitment of the next hand was published
+func (d *FairDealer) Announced() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.open
+}
+
+// Mixes the entropy into the next deck. Entropy from before the commitment was published is refused,
+// otherwise the seed could have been picked knowing it
+func (d *FairDealer) AddEntropy(entropy string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if !d.open {
+		return errors.New("Entropy can only be added after the hash of the next seed is posted and before the hand is dealt")
+	}
+	if len(entropy) > MaxEntropyLength {
+		return fmt.Errorf("Entropy can be at most %d characters", MaxEntropyLength)
+	}
+	if len(d.entropy) >= MaxEntropyPerHand {
+		return errors.New("The next hand has enough entropy already")
+	}
+	d.entropy = append(d.entropy, entropy)
+	return nil
+}
+
+func (d *FairDealer) Deck() *hand.Deck {
+	d.Lock()
+	defer d.Unlock()
+
+	d.lastProof = &FairProof{Commitment: hashSeed(d.next), ServerSeed: d.next, Entropy: d.entropy}
+	d.lastDeck = FairDeck(d.next, d.entropy)
+	d.newSeed()
+	d.open = false
+
+	cards := make([]*hand.Card, len(d.lastDeck))
+	copy(cards, d.lastDeck)
+	return &hand.Deck{Cards: cards}
+}
+
+func (d *FairDealer) Last() (int64, []*hand.Card) {
+	d.Lock()
+	defer d.Unlock()
+	return 0, d.lastDeck
+}
+
+// Returns the proof of the last deck dealt
+func (d *FairDealer) LastProof() *FairProof {
+	d.Lock()
+	defer d.Unlock()
+	return d.lastProof
+}
+
+// FairDeck derives the deck from the server seed and the entropy. The key is sha256 of the seed followed by
+// sha256 of every entropy string, then hand.Cards() is shuffled with Fisher-Yates where the i'th number is the first
+// 8 bytes (big endian) of sha256(key + i as 8 bytes big endian), numbers that would make it biased are skipped
+func FairDeck(serverSeed string, entropy []string) []*hand.Card {
+	keyHash := sha256.New()
+	keyHash.Write([]byte(serverSeed))
+	for _, e := range entropy {
+		sum := sha256.Sum256([]byte(e))
+		keyHash.Write(sum[:])
+	}
+	key := keyHash.Sum(nil)
+
+	counter := uint64(0)
+	random := func() uint64 {
+		buf := make([]byte, len(key)+8)
+		copy(buf, key)
+		binary.BigEndian.PutUint64(buf[len(key):], counter)
+		counter++
+		sum := sha256.Sum256(buf)
+		return binary.BigEndian.Uint64(sum[:8])
+	}
+
+	cards := hand.Cards()
+	for i := len(cards) - 1; i > 0; i-- {
+		n := uint64(i + 1)
+		limit := ^uint64(0) - (^uint64(0) % n)
+		r := random()
+		for r >= limit {
+			r = random()
+		}
+		j := int(r % n)
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+	return cards
+}
+
+// VerifyHand checks the revealed seed matches the commitment, the deck came from the seed and the entropy
+// and that replaying the hand pays out the same
+func VerifyHand(h *HandHistory) error {
+	if h.Fair == nil {
+		return errors.New("This hand wasn't dealt by the provably fair dealer")
+	}
+
+	if hashSeed(h.Fair.ServerSeed) != h.Fair.Commitment {
+		return errors.New("The revealed seed doesn't match the published hash")
+	}
+
+	deck := psCards(FairDeck(h.Fair.ServerSeed, h.Fair.Entropy))
+	if strings.Join(deck, " ") != strings.Join(h.Deck, " ") {
+		return errors.New("The deck wasn't derived from the seed and entropy")
+	}
+
+	result, err := ReplayHand(h)
+	if err != nil {
+		return err
+	}
+	if !result.Matches() {
+		return errors.New("Replaying the hand gives a different result: " + strings.Join(result.Differences, ", "))
+	}
+	return nil
+}
+
+// Lets the table switch dealers after it's created, the joker table keeps the one it was created with
+type tableDealer struct {
+	t *Table
+}
+
+func (d *tableDealer) Deck() *hand.Deck {
+	return d.t.Dealer.Deck()
+}
+
+// Turns the provably fair dealer on or off, table should be locked
+func (t *Table) SetFair(fair bool) {
+	if _, ok := t.Dealer.(*FairDealer); ok == fair {
+		return
+	}
+
+	if fair {
+		t.Dealer = NewFairDealer()
+	} else {
+		t.Dealer = t.Manager.dealer()
+	}
+}
+
+func (t *Table) IsFair() bool {
+	_, ok := t.Dealer.(*FairDealer)
+	return ok
+}
+
+// Publishes the hash of the next seed if the table is provably fair and it's not out already
+func (t *Table) announceCommitment() {
+	dealer, ok := t.Dealer.(*FairDealer)
+	if !ok || dealer.Announced() {
+		return
+	}
+	t.Send(fmt.Sprintf("The next hand is dealt from the seed with the sha256 hash `%s`, mix in your own randomness with `entropy <anything>`", dealer.Announce()))
+}
+
+// Reveals the seed of the recorded hand if it was provably fair
+func (t *Table) revealSeed(h *HandHistory) {
+	if h.Fair == nil {
+		return
+	}
+	t.Send(fmt.Sprintf("Hand #%d was dealt from the seed `%s`, check it with `verify %d`", h.ID, h.Fair.ServerSeed, h.ID))
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/joker/hand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// How long to wait for a message before failing
+const expectTimeout = time.Second * 5
+
+type FakeMessage struct {
+	Channel  string // Empty for private messages
+	User     string // Who a private message was sent to
+	Content  string
+	Controls []*Control
+	File     string // Name of the attached file
+	View     string // Id of the view if it's one, or an edit of one
+
+	seen bool
+}
+
+// FakeChat is an in process chat service, it keeps every message sent so tests can look for them
+type FakeChat struct {
+	sync.Mutex
+	Messages []*FakeMessage
+
+	views int
+}
+
+func (f *FakeChat) add(m *FakeMessage) {
+	f.Lock()
+	f.Messages = append(f.Messages, m)
+	f.Unlock()
+}
+
+func (f *FakeChat) SendMessage(channel, msg string) {
+	f.add(&FakeMessage{Channel: channel, Content: msg})
+}
+
+func (f *FakeChat) SendPrivateMessage(userID, msg string) {
+	f.add(&FakeMessage{User: userID, Content: msg})
+}
+
+func (f *FakeChat) SendFile(channel, msg, name string, data []byte) {
+	f.add(&FakeMessage{Channel: channel, Content: msg, File: name})
+}
+
+func (f *FakeChat) SendPrivateFile(userID, msg, name string, data []byte) {
+	f.add(&FakeMessage{User: userID, Content: msg, File: name})
+}
+
+func (f *FakeChat) SendView(channel string, view *View, controls []*Control) string {
+	f.Lock()
+	f.views++
+	id := fmt.Sprintf("view-%d", f.views)
+	f.Unlock()
+
+	f.EditView(channel, id, view, controls)
+	return id
+}
+
+// Edits are added as new messages for the view so tests can wait for them
+func (f *FakeChat) EditView(channel, viewID string, view *View, controls []*Control) {
+	f.add(&FakeMessage{Channel: channel, Content: view.String(), Controls: controls, View: viewID})
+}
+
+func (f *FakeChat) SendControls(channel, msg string, controls []*Control) {
+	f.add(&FakeMessage{Channel: channel, Content: msg, Controls: controls})
+}
+
+// Returns the controls of the last message with controls in the channel
+func (f *FakeChat) lastControls(channel string) []*Control {
+	f.Lock()
+	defer f.Unlock()
+	for i := len(f.Messages) - 1; i >= 0; i-- {
+		if m := f.Messages[i]; m.Channel == channel && m.Controls != nil {
+			return m.Controls
+		}
+	}
+	return nil
+}
+
+func (f *FakeChat) UserName(userID string) string {
+	return userID
+}
+
+func (f *FakeChat) GuildID(channel string) string {
+	return LocalGuild
+}
+
+func (f *FakeChat) IsAdmin(userID, channel string) bool {
+	return true
+}
+
+// Messages are sent with harness.Say instead
+func (f *FakeChat) Run(handler func(m *IncomingMessage)) error {
+	return nil
+}
+
+// Returns the first message not looked at before that matches, messages are sent from different goroutines
+// so they can arrive in any order
+func (f *FakeChat) take(match func(m *FakeMessage) bool) *FakeMessage {
+	f.Lock()
+	defer f.Unlock()
+	for _, m := range f.Messages {
+		if !m.seen && match(m) {
+			m.seen = true
+			return m
+		}
+	}
+	return nil
+}
+
+// harness runs the tablemanager against a FakeChat with fresh players, ledger and hand log in a temporary directory
+type harness struct {
+	t       *testing.T
+	dir     string
+	chat    *FakeChat
+	session *discordgo.Session
+	stopped bool
+}
+
+// Starts a harness, the deck is dealt the same every hand with the given cards on top
+func newHarness(t *testing.T, deck string) *harness {
+	dir, err := ioutil.TempDir("", "pokerman")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cards, err := ParseCards(deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenPlayerStore("json", filepath.Join(dir, "players.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := OpenLedger(filepath.Join(dir, "ledger.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handLog, err := OpenHandLog(filepath.Join(dir, "hands.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	TablesFile = filepath.Join(dir, "tables.json")
+	economies = nil
+
+	chat := &FakeChat{}
+	playerManager = &PlayerManager{
+		Players: make([]*Player, 0),
+		Stop:    make(chan *sync.WaitGroup),
+		Store:   store,
+		Ledger:  ledger,
+	}
+	tableManager = &TableManager{
+		tables:    make([]*Table, 0),
+		EvtChan:   make(chan interface{}),
+		HandLog:   handLog,
+		Transport: chat,
+		NewDealer: func() hand.Dealer { return NewStackedDealer(cards) },
+		HandDelay: time.Millisecond * 10,
+		BotDelay:  time.Millisecond * 10,
+	}
+
+	err = playerManager.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewOfflineSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go tableManager.Run()
+
+	return &harness{t: t, dir: dir, chat: chat, session: session}
+}
+
+// Sends the message as the user in the channel
+func (h *harness) Say(channel, user, msg string) {
+	HandleOfflineMessage(h.session, &IncomingMessage{
+		ChannelID:  channel,
+		AuthorID:   user,
+		AuthorName: user,
+		Content:    msg,
+	})
+}
+
+// Presses the control with the label on the last controls sent to the channel, like a transport would
+func (h *harness) Press(channel, user, label string) {
+	for _, c := range h.chat.lastControls(channel) {
+		if c.Label == label {
+			tableManager.HandleMessage(&IncomingMessage{ChannelID: channel, AuthorID: user, AuthorName: user, Content: c.Command})
+			return
+		}
+	}
+	h.t.Fatalf("No %q control in #%s", label, channel)
+}
+
+// Runs a script like "alice: create 100 1 2 / bob: join 100" in the channel
+func (h *harness) Script(channel, script string) {
+	for _, line := range strings.Split(script, "/") {
+		split := strings.SplitN(line, ":", 2)
+		if len(split) < 2 {
+			h.t.Fatalf("Invalid script line %q", line)
+		}
+		h.Say(channel, strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
+	}
+}
+
+func (h *harness) wait(what string, match func(m *FakeMessage) bool) string {
+	deadline := time.Now().Add(expectTimeout)
+	for time.Now().Before(deadline) {
+		if m := h.chat.take(match); m != nil {
+			return m.Content
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	h.chat.Lock()
+	for _, m := range h.chat.Messages {
+		h.t.Logf("[%s%s] %s", m.Channel, m.User, m.Content)
+	}
+	h.chat.Unlock()
+	h.t.Fatalf("Timed out waiting for %s", what)
+	return ""
+}
+
+// Waits for a message in the channel containing text
+func (h *harness) Expect(channel, text string) string {
+	return h.wait("#"+channel+" "+text, func(m *FakeMessage) bool {
+		return m.Channel == channel && strings.Contains(m.Content, text)
+	})
+}
+
+// Waits for a private message to the user containing text
+func (h *harness) ExpectPrivate(user, text string) string {
+	return h.wait("@"+user+" "+text, func(m *FakeMessage) bool {
+		return m.User == user && strings.Contains(m.Content, text)
+	})
+}
+
+var turnRegex = regexp.MustCompile(`<@(\w+)>'s Turn`)
+
+// Waits for the next turn in the channel and returns whose it is
+func (h *harness) Turn(channel string) string {
+	msg := h.wait("#"+channel+" turn", func(m *FakeMessage) bool {
+		return m.Channel == channel && turnRegex.MatchString(m.Content)
+	})
+	return turnRegex.FindStringSubmatch(msg)[1]
+}
+
+// Plays out the hand by calling or checking on every turn, returns the results message
+func (h *harness) CheckDown(channel string) string {
+	for {
+		msg := h.wait("#"+channel+" turn or results", func(m *FakeMessage) bool {
+			return m.Channel == channel && (turnRegex.MatchString(m.Content) || strings.HasPrefix(m.Content, "Results:"))
+		})
+		if strings.HasPrefix(msg, "Results:") {
+			return msg
+		}
+
+		user := turnRegex.FindStringSubmatch(msg)[1]
+		if strings.Contains(msg, "call (") {
+			h.Say(channel, user, "call")
+		} else {
+			h.Say(channel, user, "check")
+		}
+	}
+}
+
+// Returns the users balance in the global bank
+func (h *harness) Balance(user string) int {
+	p := playerManager.GetCreatePlayer(user, user)
+	p.Lock()
+	defer p.Unlock()
+	return p.Balance(GlobalBank)
+}
+
+func (h *harness) AssertBalance(user string, expected int) {
+	if balance := h.Balance(user); balance != expected {
+		h.t.Errorf("Expected %s to have $%d, has $%d", user, expected, balance)
+	}
+}
+
+// Starts shutting down like on a signal, the returned function waits till it's done
+// and checks the ledger matches the balances
+func (h *harness) Shutdown() func() {
+	h.stopped = true
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		tableManager.EvtChan <- &StopEvt{wg: &wg}
+	}()
+
+	return func() {
+		done := make(chan bool)
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(expectTimeout):
+			h.t.Fatal("Timed out waiting for the tablemanager to stop")
+		}
+
+		mismatches, err := playerManager.Ledger.Check(playerManager.Players)
+		if err != nil {
+			h.t.Error(err)
+		}
+		for _, v := range mismatches {
+			h.t.Error("Ledger mismatch:", v)
+		}
+	}
+}
+
+// Shuts down and waits for it, balances are final after this
+func (h *harness) Stop() {
+	if !h.stopped {
+		h.Shutdown()()
+	}
+}
+
+func (h *harness) Close() {
+	h.Stop()
+	tableManager.HandLog.Close()
+	playerManager.Store.Close()
+	playerManager.Ledger.Close()
+	os.RemoveAll(h.dir)
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Forced bets, recorded as actions alongside the ones players make
+const (
+	postAnte       = "ante"
+	postSmallBlind = "smallblind"
+	postBigBlind   = "bigblind"
+	postBringIn    = "bringin"
+)
+
+// A record of everything that happened in a hand
+type HandHistory struct {
+	ID      int64 // Unique across all tables
+	Time    time.Time
+	Channel string
+	Game    table.Game
+	Limit   table.Limit
+	Stakes  table.Stakes
+	Seats   int
+	Button  int
+
+	Tournament bool `json:",omitempty"` // Chips are not money
+
+	Seed int64    `json:",omitempty"` // Seed the deck was shuffled from, if it was
+	Deck []string `json:",omitempty"` // The deck in the order it was dealt from, used to replay the hand
+
+	Fair *FairProof `json:",omitempty"` // Set if the deck was dealt by the provably fair dealer
+
+	Players []*HistoryPlayer
+	Actions []*HistoryAction
+	Board   []string
+	Results []*HistoryResult
+}
+
+type HistoryPlayer struct {
+	Seat  int
+	ID    string
+	Name  string
+	Chips int      // Stack at the start of the hand
+	Cards []string `json:",omitempty"`
+}
+
+type HistoryAction struct {
+	Street int // 0 is preflop or third street in stud
+	Seat   int
+	Action string
+	Amount int // Chips put in the pot by this action
+	AllIn  bool
+	Chips  int `json:",omitempty"` // Chips the player asked to bet or raise
+}
+
+type HistoryResult struct {
+	Seat  int
+	Chips int
+	Low   bool
+	Hand  string `json:",omitempty"`
+}
+
+func (h *HandHistory) Player(seat int) *HistoryPlayer {
+	for _, p := range h.Players {
+		if p.Seat == seat {
+			return p
+		}
+	}
+	return nil
+}
+
+// Returns the chips won minus the chips put in the pot by the player in the seat
+func (h *HandHistory) Net(seat int) int {
+	net := 0
+	for _, a := range h.Actions {
+		if a.Seat == seat {
+			net -= a.Amount
+		}
+	}
+	for _, r := range h.Results {
+		if r.Seat == seat {
+			net += r.Chips
+		}
+	}
+	return net
+}
+
+func (h *HandHistory) HasPlayer(id string) bool {
+	for _, p := range h.Players {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the players and the forced bets, called after the table dealt a new hand.
+// stacks is the chips everyone had before the hand started
+func (t *Table) startHistory(stacks map[int]int) {
+	h := &HandHistory{
+		Time:    time.Now(),
+		Channel: t.Channel,
+		Game:    t.Table.Game(),
+		Limit:   t.Table.Limit(),
+		Stakes:  t.Table.Stakes(),
+		Seats:   t.Table.NumOfSeats(),
+		Button:  t.Table.Button(),
+
+		Tournament: t.IsTournament(),
+	}
+
+	if dealer, ok := t.Dealer.(RecordingDealer); ok {
+		seed, deck := dealer.Last()
+		h.Seed = seed
+		h.Deck = psCards(deck)
+	}
+	if dealer, ok := t.Dealer.(*FairDealer); ok {
+		h.Fair = dealer.LastProof()
+	}
+
+	// Whatever went in the pot before anyone acted was antes and blinds
+	posted := make(map[int]int)
+	biggest := 0
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		p, ok := t.Table.Players()[seat]
+		if !ok {
+			continue
+		}
+
+		tablePlayer := asTablePlayer(p.Player())
+		h.Players = append(h.Players, &HistoryPlayer{Seat: seat, ID: tablePlayer.Id, Name: tablePlayer.Name, Chips: stacks[seat]})
+
+		put := stacks[seat] - p.Chips()
+		if h.Stakes.Ante > 0 && put > 0 {
+			ante := h.Stakes.Ante
+			if put < ante {
+				ante = put
+			}
+			h.Actions = append(h.Actions, &HistoryAction{Seat: seat, Action: postAnte, Amount: ante, AllIn: p.Chips() == 0 && put == ante})
+			put -= ante
+		}
+
+		if put > 0 {
+			posted[seat] = put
+			if put > biggest {
+				biggest = put
+			}
+		}
+	}
+
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		put, ok := posted[seat]
+		if !ok {
+			continue
+		}
+
+		action := postSmallBlind
+		if IsStud(h.Game) {
+			action = postBringIn
+		} else if put == biggest {
+			action = postBigBlind
+		}
+		h.Actions = append(h.Actions, &HistoryAction{Seat: seat, Action: action, Amount: put, AllIn: t.Table.Players()[seat].Chips() == 0})
+	}
+
+	t.history = h
+}
+
+// Keeps track of the hand after every step of the table, stacks is the chips everyone had before it
+func (t *Table) recordHistory(stacks map[int]int, results map[int][]*table.Result, done bool) {
+	if results == nil && done {
+		return
+	}
+
+	if results == nil && !t.inHand {
+		t.startHistory(stacks)
+	}
+
+	h := t.history
+	if h == nil {
+		return
+	}
+
+	won := make(map[int]int)
+	for seat, resultList := range results {
+		for _, result := range resultList {
+			won[seat] += result.Chips
+		}
+	}
+
+	if t.pendingAction != nil {
+		action := t.pendingAction
+		t.pendingAction = nil
+		if p, ok := t.Table.Players()[action.Seat]; ok {
+			action.Amount = stacks[action.Seat] - p.Chips() + won[action.Seat]
+			action.AllIn = action.Amount > 0 && action.Amount == stacks[action.Seat]
+		}
+		h.Actions = append(h.Actions, action)
+	}
+
+	for seat, p := range t.Table.Players() {
+		hp := h.Player(seat)
+		if hp == nil || len(p.HoleCards()) < len(hp.Cards) {
+			continue
+		}
+
+		hp.Cards = hp.Cards[:0]
+		for _, hc := range p.HoleCards() {
+			hp.Cards = append(hp.Cards, psCard(hc.Card))
+		}
+	}
+
+	if board := t.Table.Board(); len(board) >= len(h.Board) {
+		h.Board = psCards(board)
+	}
+
+	if results == nil {
+		return
+	}
+
+	for seat, resultList := range results {
+		for _, result := range resultList {
+			hr := &HistoryResult{Seat: seat, Chips: result.Chips, Low: result.Share == table.WonLow || result.Share == table.SplitLow}
+			if result.Hand != nil {
+				hr.Hand = result.Hand.Description()
+			}
+			h.Results = append(h.Results, hr)
+		}
+	}
+	sort.Slice(h.Results, func(i, j int) bool { return h.Results[i].Seat < h.Results[j].Seat })
+
+	t.history = nil
+	if t.Manager.HandLog == nil {
+		return
+	}
+
+	err := t.Manager.HandLog.Record(h)
+	if err != nil {
+		log.Println("Failed recording hand history:", err)
+	} else {
+		t.revealSeed(h)
+	}
+
+	playerManager.RecordHand(h, t.Manager.Transport.GuildID(t.Channel))
+}
+
+// Returns the current betting round, called while a player is acting
+func (t *Table) street() int {
+	if IsStud(t.Table.Game()) {
+		current := t.Table.CurrentPlayer()
+		if current == nil || len(current.HoleCards()) < 3 {
+			return 0
+		}
+		return len(current.HoleCards()) - 3
+	}
+
+	board := len(t.Table.Board())
+	if board < 3 {
+		return 0
+	}
+	return board - 2
+}
+
+// Returns the chips of everyone at the table by seat
+func (t *Table) stacks() map[int]int {
+	stacks := make(map[int]int)
+	for seat, p := range t.Table.Players() {
+		stacks[seat] = p.Chips()
+	}
+	return stacks
+}
+
+var psSuits = map[hand.Suit]string{
+	hand.Spades:   "s",
+	hand.Hearts:   "h",
+	hand.Diamonds: "d",
+	hand.Clubs:    "c",
+}
+
+// Returns the card the way hand history formats write it, like As or Td
+func psCard(c *hand.Card) string {
+	rank := string(c.Rank())
+	if rank == "10" {
+		rank = "T"
+	}
+	return rank + psSuits[c.Suit()]
+}
+
+func psCards(cards []*hand.Card) []string {
+	out := make([]string, len(cards))
+	for k, c := range cards {
+		out[k] = psCard(c)
+	}
+	return out
+}
+
+var psGameNames = map[table.Game]string{
+	table.Holdem:    "Hold'em",
+	table.OmahaHi:   "Omaha",
+	table.OmahaHiLo: "Omaha Hi/Lo",
+	table.StudHi:    "7 Card Stud",
+	table.StudHiLo:  "7 Card Stud Hi/Lo",
+	table.Razz:      "Razz",
+}
+
+var psLimitNames = map[table.Limit]string{
+	table.NoLimit:    "No Limit",
+	table.PotLimit:   "Pot Limit",
+	table.FixedLimit: "Limit",
+}
+
+var (
+	psFlopStreets = []string{"HOLE CARDS", "FLOP", "TURN", "RIVER"}
+	psStudStreets = []string{"3rd STREET", "4th STREET", "5th STREET", "6th STREET", "RIVER"}
+
+	psFlopFolds = []string{"before Flop", "on the Flop", "on the Turn", "on the River"}
+	psStudFolds = []string{"on the 3rd Street", "on the 4th Street", "on the 5th Street", "on the 6th Street", "on the River"}
+)
+
+// PokerStars formats the hand the way PokerStars writes hand histories, so it can be imported into tracking software.
+// Hole cards are only shown for hero and for players that went to showdown
+func (h *HandHistory) PokerStars(heroID string) string {
+	out := fmt.Sprintf("PokerStars Hand #%d: %s %s ($%d/$%d USD) - %s UTC\n", h.ID, psGameNames[h.Game], psLimitNames[h.Limit],
+		h.Stakes.SmallBet, h.Stakes.BigBet, h.Time.UTC().Format("2006/01/02 15:04:05"))
+
+	stud := IsStud(h.Game)
+	if stud {
+		out += fmt.Sprintf("Table '%s' %d-max\n", h.Channel, h.Seats)
+	} else {
+		out += fmt.Sprintf("Table '%s' %d-max Seat #%d is the button\n", h.Channel, h.Seats, h.Button+1)
+	}
+
+	for _, p := range h.Players {
+		out += fmt.Sprintf("Seat %d: %s (%d in chips)\n", p.Seat+1, p.Name, p.Chips)
+	}
+
+	streets, folds := psFlopStreets, psFlopFolds
+	if stud {
+		streets, folds = psStudStreets, psStudFolds
+	}
+
+	folded := make(map[int]int) // Seat -> street folded on
+	bets := make(map[int]int)   // Chips put in this street
+	toCall := 0
+	street := -1
+	for _, action := range h.Actions {
+		name := h.Player(action.Seat).Name
+		forced := action.Action == postAnte || action.Action == postSmallBlind || action.Action == postBigBlind
+		if !forced && action.Street > street {
+			for street < action.Street && street < len(streets)-1 {
+				street++
+				out += h.psStreet(streets, street, heroID)
+			}
+
+			// Blinds count towards the first round
+			if street > 0 {
+				bets = make(map[int]int)
+				toCall = 0
+			}
+		}
+
+		bets[action.Seat] += action.Amount
+		allIn := ""
+		if action.AllIn {
+			allIn = " and is all-in"
+		}
+
+		switch action.Action {
+		case postAnte:
+			out += fmt.Sprintf("%s: posts the ante %d%s\n", name, action.Amount, allIn)
+			bets[action.Seat] -= action.Amount
+		case postSmallBlind:
+			out += fmt.Sprintf("%s: posts small blind %d%s\n", name, action.Amount, allIn)
+		case postBigBlind:
+			out += fmt.Sprintf("%s: posts big blind %d%s\n", name, action.Amount, allIn)
+		case postBringIn:
+			out += fmt.Sprintf("%s: brings in for %d%s\n", name, action.Amount, allIn)
+		case string(table.Fold):
+			out += fmt.Sprintf("%s: folds\n", name)
+			folded[action.Seat] = action.Street
+		case string(table.Check):
+			out += fmt.Sprintf("%s: checks\n", name)
+		case string(table.Call):
+			out += fmt.Sprintf("%s: calls %d%s\n", name, action.Amount, allIn)
+		case string(table.Bet):
+			out += fmt.Sprintf("%s: bets %d%s\n", name, action.Amount, allIn)
+		case string(table.Raise):
+			out += fmt.Sprintf("%s: raises %d to %d%s\n", name, bets[action.Seat]-toCall, bets[action.Seat], allIn)
+		}
+
+		if bets[action.Seat] > toCall {
+			toCall = bets[action.Seat]
+		}
+	}
+
+	// Streets dealt after everyone was all in
+	last := 0
+	if stud {
+		for _, p := range h.Players {
+			if len(p.Cards)-3 > last {
+				last = len(p.Cards) - 3
+			}
+		}
+	} else if len(h.Board) >= 3 {
+		last = len(h.Board) - 2
+	}
+	for street < last && street < len(streets)-1 {
+		street++
+		out += h.psStreet(streets, street, heroID)
+	}
+
+	showdown := len(h.Players)-len(folded) > 1
+	if showdown {
+		out += "*** SHOW DOWN ***\n"
+		for _, p := range h.Players {
+			if _, ok := folded[p.Seat]; !ok {
+				out += fmt.Sprintf("%s: shows [%s]\n", p.Name, strings.Join(p.Cards, " "))
+			}
+		}
+	}
+
+	total := 0
+	won := make(map[int]int)
+	for _, r := range h.Results {
+		total += r.Chips
+		won[r.Seat] += r.Chips
+		if r.Chips > 0 {
+			out += fmt.Sprintf("%s collected %d from pot\n", h.Player(r.Seat).Name, r.Chips)
+		}
+	}
+
+	out += "*** SUMMARY ***\n"
+	out += fmt.Sprintf("Total pot %d | Rake 0\n", total)
+	if len(h.Board) > 0 {
+		out += fmt.Sprintf("Board [%s]\n", strings.Join(h.Board, " "))
+	}
+
+	for _, p := range h.Players {
+		line := fmt.Sprintf("Seat %d: %s", p.Seat+1, p.Name)
+		if p.Seat == h.Button && !stud {
+			line += " (button)"
+		}
+
+		if foldedOn, ok := folded[p.Seat]; ok {
+			line += " folded " + folds[foldedOn]
+		} else if showdown && won[p.Seat] > 0 {
+			line += fmt.Sprintf(" showed [%s] and won (%d)", strings.Join(p.Cards, " "), won[p.Seat])
+		} else if showdown {
+			line += fmt.Sprintf(" showed [%s] and lost", strings.Join(p.Cards, " "))
+		} else if won[p.Seat] > 0 {
+			line += fmt.Sprintf(" collected (%d)", won[p.Seat])
+		}
+		out += line + "\n"
+	}
+
+	return out
+}
+
+// Returns the header for a street, including the cards dealt on it
+func (h *HandHistory) psStreet(streets []string, street int, heroID string) string {
+	out := "*** " + streets[street] + " ***"
+
+	if IsStud(h.Game) {
+		out += "\n"
+		for _, p := range h.Players {
+			if p.ID != heroID || len(p.Cards) < street+3 {
+				continue
+			}
+			if street == 0 {
+				out += fmt.Sprintf("Dealt to %s [%s]\n", p.Name, strings.Join(p.Cards[:3], " "))
+			} else {
+				out += fmt.Sprintf("Dealt to %s [%s] [%s]\n", p.Name, strings.Join(p.Cards[:street+2], " "), p.Cards[street+2])
+			}
+		}
+		return out
+	}
+
+	switch street {
+	case 0:
+		out += "\n"
+		for _, p := range h.Players {
+			if p.ID == heroID && len(p.Cards) > 0 {
+				out += fmt.Sprintf("Dealt to %s [%s]\n", p.Name, strings.Join(p.Cards, " "))
+			}
+		}
+	case 1:
+		out += fmt.Sprintf(" [%s]\n", strings.Join(h.Board[:3], " "))
+	default:
+		out += fmt.Sprintf(" [%s] [%s]\n", strings.Join(h.Board[:street+1], " "), h.Board[street+1])
+	}
+	return out
+}
+
+// HandLog stores hand histories, one json encoded hand per line
+type HandLog struct {
+	sync.Mutex
+	Path string
+
+	file   *os.File
+	lastID int64
+
+	Stats *HandStats
+}
+
+func OpenHandLog(path string) (*HandLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &HandLog{Path: path, file: file, Stats: NewHandStats()}
+	err = l.ForEach(func(h *HandHistory) {
+		if h.ID > l.lastID {
+			l.lastID = h.ID
+		}
+		l.Stats.Add(h)
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Record gives the hand an id and writes it to the log
+func (l *HandLog) Record(h *HandHistory) error {
+	l.Lock()
+	defer l.Unlock()
+
+	h.ID = l.lastID + 1
+	encoded, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.file.Write(append(encoded, '\n'))
+	if err != nil {
+		return err
+	}
+
+	l.lastID = h.ID
+	l.Stats.Add(h)
+	return nil
+}
+
+// Calls fn for every hand in the log, oldest first
+func (l *HandLog) ForEach(fn func(h *HandHistory)) error {
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var h *HandHistory
+		err := json.Unmarshal(scanner.Bytes(), &h)
+		if err != nil {
+			return err
+		}
+		fn(h)
+	}
+	return scanner.Err()
+}
+
+// Returns the last n hands the player played in, oldest first
+func (l *HandLog) Recent(playerID string, n int) ([]*HandHistory, error) {
+	hands := make([]*HandHistory, 0, n)
+	err := l.ForEach(func(h *HandHistory) {
+		if !h.HasPlayer(playerID) {
+			return
+		}
+		if len(hands) >= n {
+			hands = hands[1:]
+		}
+		hands = append(hands, h)
+	})
+	return hands, err
+}
+
+// Returns the hand with the id, nil if there's none
+func (l *HandLog) Get(id int64) (*HandHistory, error) {
+	var found *HandHistory
+	err := l.ForEach(func(h *HandHistory) {
+		if h.ID == id {
+			found = h
+		}
+	})
+	return found, err
+}
+
+func (l *HandLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const LeaderboardPageSize = 10
+
+// What players can be ranked by, money is ranked by the balance in a bank
+var leaderboards = map[string]func(p *Player, bank string) int{
+	"money":       func(p *Player, bank string) int { return p.Balance(bank) },
+	"profit":      func(p *Player, bank string) int { return p.Profit },
+	"hands":       func(p *Player, bank string) int { return p.Hands },
+	"tournaments": func(p *Player, bank string) int { return p.Prizes },
+}
+
+type LeaderboardEntry struct {
+	ID    string
+	Name  string
+	Value int
+}
+
+// Ranked by value, ties by id so every entry has exactly one place it can be at
+func (e *LeaderboardEntry) before(o *LeaderboardEntry) bool {
+	if e.Value != o.Value {
+		return e.Value > o.Value
+	}
+	return e.ID < o.ID
+}
+
+// A leaderboard kept sorted, players that changed are moved to their new place instead of sorting it all again
+type leaderboardIndex struct {
+	board, bank, guild string
+
+	entries []*LeaderboardEntry
+	byID    map[string]*LeaderboardEntry
+}
+
+// Returns where the entry is or would go
+func (idx *leaderboardIndex) search(e *LeaderboardEntry) int {
+	return sort.Search(len(idx.entries), func(i int) bool { return !idx.entries[i].before(e) })
+}
+
+// Moves the player to where they belong now, or off the board if they don't. Player should be locked
+func (idx *leaderboardIndex) update(p *Player) {
+	if old, ok := idx.byID[p.ID]; ok {
+		i := idx.search(old)
+		idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+		delete(idx.byID, p.ID)
+	}
+
+	// Only players with a wallet in isolated banks are ranked there
+	if _, ok := p.Wallets[idx.bank]; idx.bank != GlobalBank && !ok {
+		return
+	}
+	if idx.guild != "" && !p.InGuild(idx.guild) {
+		return
+	}
+
+	e := &LeaderboardEntry{ID: p.ID, Name: p.Name, Value: leaderboards[idx.board](p, idx.bank)}
+	i := idx.search(e)
+	idx.entries = append(idx.entries, nil)
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = e
+	idx.byID[p.ID] = e
+}
+
+// Queues the player to be moved on the leaderboards, safe to call while holding a players lock
+func (pm *PlayerManager) MarkChanged(p *Player) {
+	pm.changedLock.Lock()
+	if pm.changed == nil {
+		pm.changed = make(map[*Player]bool)
+	}
+	pm.changed[p] = true
+	pm.changedLock.Unlock()
+}
+
+// Remembers the player played in the guild so the server leaderboards only look at its players, player should be locked
+func (pm *PlayerManager) addToGuild(p *Player, guild string) {
+	pm.guildLock.Lock()
+	if pm.byGuild == nil {
+		pm.byGuild = make(map[string][]*Player)
+	}
+	pm.byGuild[guild] = append(pm.byGuild[guild], p)
+	pm.guildLock.Unlock()
+}
+
+// Drops the leaderboards and indexes the players by guild again, after loading them
+func (pm *PlayerManager) resetIndexes(players []*Player) {
+	pm.indexLock.Lock()
+	pm.indexes = nil
+	pm.indexLock.Unlock()
+
+	pm.guildLock.Lock()
+	pm.byGuild = make(map[string][]*Player)
+	pm.guildLock.Unlock()
+
+	for _, p := range players {
+		p.Lock()
+		for _, guild := range p.Guilds {
+			pm.addToGuild(p, guild)
+		}
+		p.Unlock()
+	}
+}
+
+// Returns the sorted leaderboard, building it the first time it's looked at. indexLock should be held
+func (pm *PlayerManager) index(board, bank, guild string) *leaderboardIndex {
+	// Move everyone that changed on the boards that are already built
+	pm.changedLock.Lock()
+	changed := pm.changed
+	pm.changed = nil
+	pm.changedLock.Unlock()
+
+	for p := range changed {
+		p.Lock()
+		for _, idx := range pm.indexes {
+			idx.update(p)
+		}
+		p.Unlock()
+	}
+
+	key := board + "/" + bank + "/" + guild
+	if idx, ok := pm.indexes[key]; ok {
+		return idx
+	}
+
+	var players []*Player
+	if guild != "" {
+		pm.guildLock.Lock()
+		players = append(players, pm.byGuild[guild]...)
+		pm.guildLock.Unlock()
+	} else {
+		pm.RLock()
+		players = append(players, pm.Players...)
+		pm.RUnlock()
+	}
+
+	idx := &leaderboardIndex{board: board, bank: bank, guild: guild, byID: make(map[string]*LeaderboardEntry)}
+	for _, p := range players {
+		p.Lock()
+		idx.update(p)
+		p.Unlock()
+	}
+
+	if pm.indexes == nil {
+		pm.indexes = make(map[string]*leaderboardIndex)
+	}
+	pm.indexes[key] = idx
+	return idx
+}
+
+// A page of a leaderboard and where the player asking is on it
+type LeaderboardPage struct {
+	Board   string
+	Page    int
+	Pages   int
+	Start   int // Entries before this page
+	Entries []*LeaderboardEntry
+
+	Self *LeaderboardEntry // Nil if the player isn't on the board
+	Rank int
+}
+
+// Returns the page of the players ranked by the board, only the ones that played in the guild if it's set.
+// Money is ranked by the balances in the bank
+func (pm *PlayerManager) Leaderboard(board, guild, bank string, page int, playerID string) *LeaderboardPage {
+	pm.indexLock.Lock()
+	defer pm.indexLock.Unlock()
+
+	if board != "money" {
+		bank = GlobalBank
+	}
+	if bank != GlobalBank {
+		guild = "" // Isolated banks are only used by their own guild already
+	}
+
+	idx := pm.index(board, bank, guild)
+
+	pages := (len(idx.entries) + LeaderboardPageSize - 1) / LeaderboardPageSize
+	if pages < 1 {
+		pages = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	start := (page - 1) * LeaderboardPageSize
+	end := start + LeaderboardPageSize
+	if end > len(idx.entries) {
+		end = len(idx.entries)
+	}
+
+	// Copied since the index keeps changing after the lock is let go
+	out := &LeaderboardPage{Board: board, Page: page, Pages: pages, Start: start}
+	out.Entries = append(out.Entries, idx.entries[start:end]...)
+	if self, ok := idx.byID[playerID]; ok {
+		out.Self = self
+		out.Rank = idx.search(self) + 1
+	}
+	return out
+}
+
+// Parses the leaderboard arguments, they can be given in any order like "profit global 2"
+func ParseLeaderboardArgs(args []string) (board string, global bool, page int, err error) {
+	board = "money"
+	page = 1
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		if _, ok := leaderboards[arg]; ok {
+			board = arg
+			continue
+		}
+
+		switch arg {
+		case "server", "guild":
+			global = false
+		case "global", "all":
+			global = true
+		default:
+			page, err = strconv.Atoi(arg)
+			if err != nil || page < 1 {
+				return "", false, 0, errors.New("Usage: `leaderboard [money|profit|hands|tournaments] [server|global] [page]`")
+			}
+		}
+	}
+	return
+}
+
+func formatLeaderboardValue(board string, value int) string {
+	if board == "hands" {
+		return strconv.Itoa(value)
+	}
+	if value < 0 {
+		return fmt.Sprintf("-$%d", -value)
+	}
+	return fmt.Sprintf("$%d", value)
+}
+
+// Formats a page of the leaderboard with the rank of the player asking appended
+func FormatLeaderboard(scope string, page *LeaderboardPage) string {
+	out := fmt.Sprintf("**%s leaderboard** (%s), page %d/%d\n", strings.Title(page.Board), scope, page.Page, page.Pages)
+	if len(page.Entries) < 1 {
+		return out + "Nobody here yet"
+	}
+
+	for i, e := range page.Entries {
+		out += fmt.Sprintf("#%d **%s** %s\n", page.Start+i+1, e.Name, formatLeaderboardValue(page.Board, e.Value))
+	}
+
+	if page.Self != nil {
+		return out + fmt.Sprintf("\nYou are #%d with %s", page.Rank, formatLeaderboardValue(page.Board, page.Self.Value))
+	}
+	return out + "\nYou are not on this leaderboard yet"
+}
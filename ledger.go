@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons money can change
+const (
+	ReasonOpening   = "opening" // Balance from before the ledger existed
+	ReasonNewPlayer = "newplayer"
+	ReasonFreeMoney = "freemoney"
+	ReasonBuyIn     = "buyin"
+	ReasonRefund    = "refund"
+	ReasonCashOut   = "cashout"
+	ReasonPrize     = "prize"
+
+	// Bots play with house money, it's created when they sit down and destroyed when they stand up
+	ReasonHouseBuyIn   = "housebuyin"
+	ReasonHouseCashOut = "housecashout"
+)
+
+// Faucets are where new money comes from, everything else just moves it around.
+// House cash outs are negative so they take away the money bots leave with
+func IsFaucet(reason string) bool {
+	return reason == ReasonOpening || reason == ReasonNewPlayer || reason == ReasonFreeMoney || IsHouse(reason)
+}
+
+// House money is never in anyones wallet
+func IsHouse(reason string) bool {
+	return reason == ReasonHouseBuyIn || reason == ReasonHouseCashOut
+}
+
+// Where a change in money came from
+type MoneySource struct {
+	Reason  string
+	Channel string
+	Hand    int
+	Bank    string // GlobalBank or the guild with an isolated economy
+}
+
+type LedgerEntry struct {
+	Time     time.Time
+	PlayerID string
+	Delta    int
+	Reason   string
+	Channel  string `json:",omitempty"`
+	Hand     int    `json:",omitempty"`
+	Bank     string `json:",omitempty"`
+}
+
+func (e *LedgerEntry) String() string {
+	out := fmt.Sprintf("`%s` **%+d** %s", e.Time.UTC().Format("2006-01-02 15:04"), e.Delta, e.Reason)
+	if e.Channel != "" {
+		out += " in <#" + e.Channel + ">"
+	}
+	if e.Hand != 0 {
+		out += fmt.Sprintf(" (hand %d)", e.Hand)
+	}
+	if e.Bank != GlobalBank {
+		out += " [server bank]"
+	}
+	return out
+}
+
+// Ledger is an append only log of every change to a players money, one json entry per line
+type Ledger struct {
+	sync.Mutex
+	Path string
+
+	file    *os.File
+	faucets int
+}
+
+func OpenLedger(path string) (*Ledger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Ledger{Path: path, file: file}
+	err = l.ForEach(func(entry *LedgerEntry) {
+		if IsFaucet(entry.Reason) {
+			l.faucets += entry.Delta
+		}
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Faucets returns the total amount of money that has been created
+func (l *Ledger) Faucets() int {
+	l.Lock()
+	defer l.Unlock()
+	return l.faucets
+}
+
+// Empty returns true if nothing has been recorded yet
+func (l *Ledger) Empty() bool {
+	l.Lock()
+	defer l.Unlock()
+
+	stat, err := l.file.Stat()
+	return err == nil && stat.Size() == 0
+}
+
+func (l *Ledger) Record(playerID string, delta int, src MoneySource) error {
+	entry := &LedgerEntry{
+		Time:     time.Now(),
+		PlayerID: playerID,
+		Delta:    delta,
+		Reason:   src.Reason,
+		Channel:  src.Channel,
+		Hand:     src.Hand,
+		Bank:     src.Bank,
+	}
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	_, err = l.file.Write(append(encoded, '\n'))
+	if err != nil {
+		return err
+	}
+
+	if IsFaucet(entry.Reason) {
+		l.faucets += entry.Delta
+	}
+	return l.file.Sync()
+}
+
+// Records the current balances of players as opening entries, used the first time the ledger is created
+func (l *Ledger) RecordOpening(players []*Player) error {
+	for _, p := range players {
+		p.Lock()
+		err := l.Record(p.ID, p.Money, MoneySource{Reason: ReasonOpening})
+		for bank, balance := range p.Wallets {
+			if err == nil {
+				err = l.Record(p.ID, balance, MoneySource{Reason: ReasonOpening, Bank: bank})
+			}
+		}
+		p.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls fn for every entry in the ledger, in the order they were recorded
+func (l *Ledger) ForEach(fn func(entry *LedgerEntry)) error {
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry *LedgerEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
+
+// Returns the last n entries for the player, newest first
+func (l *Ledger) Recent(playerID string, n int) ([]*LedgerEntry, error) {
+	entries := make([]*LedgerEntry, 0, n)
+	err := l.ForEach(func(entry *LedgerEntry) {
+		if entry.PlayerID != playerID {
+			return
+		}
+		if len(entries) >= n {
+			entries = entries[1:]
+		}
+		entries = append(entries, entry)
+	})
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
+
+type walletKey struct {
+	Bank     string
+	PlayerID string
+}
+
+// Replay reconstructs the balance of every player in every bank from the ledger
+func (l *Ledger) Replay() (map[walletKey]int, error) {
+	balances := make(map[walletKey]int)
+	err := l.ForEach(func(entry *LedgerEntry) {
+		if IsHouse(entry.Reason) {
+			return
+		}
+		balances[walletKey{Bank: entry.Bank, PlayerID: entry.PlayerID}] += entry.Delta
+	})
+	return balances, err
+}
+
+// Check replays the ledger and compares it against the players balances, returning a line for each mismatch
+func (l *Ledger) Check(players []*Player) ([]string, error) {
+	balances, err := l.Replay()
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := make([]string, 0)
+	seen := make(map[walletKey]bool)
+	for _, p := range players {
+		p.Lock()
+		banks := []string{GlobalBank}
+		for bank := range p.Wallets {
+			banks = append(banks, bank)
+		}
+		sort.Strings(banks)
+
+		for _, bank := range banks {
+			key := walletKey{Bank: bank, PlayerID: p.ID}
+			if balances[key] != p.Balance(bank) {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%s)%s: stored $%d, ledger $%d", p.Name, p.ID, bankSuffix(bank), p.Balance(bank), balances[key]))
+			}
+			seen[key] = true
+		}
+		p.Unlock()
+	}
+
+	missing := make([]string, 0)
+	for key, balance := range balances {
+		if !seen[key] {
+			missing = append(missing, fmt.Sprintf("%s%s: not stored, ledger $%d", key.PlayerID, bankSuffix(key.Bank), balance))
+		}
+	}
+	sort.Strings(missing)
+
+	return append(mismatches, missing...), nil
+}
+
+func bankSuffix(bank string) string {
+	if bank == GlobalBank {
+		return ""
+	}
+	return " in bank " + bank
+}
+
+func (l *Ledger) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/dutil/commandsystem"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LocalGuild  = "local"
+	LocalBotID  = "pokerman"
+	LocalPrefix = "local-" // Files used in local mode are prefixed with this so real data isn't touched
+
+	LocalFilesDir = LocalPrefix + "files" // Where files sent in local mode end up
+)
+
+const localHelp = `Lines are sent as the current user in the current channel, mention users with @name and channels with #name
+ :user <name>      Switch to another user (alias :as)
+ :channel <name>   Switch to another channel (alias :in)
+ <name>> <text>    Send a single message as another user
+ :help             Show this
+ :quit             Shut down`
+
+var (
+	localUserMention    = regexp.MustCompile(`\B@([\w-]+)`)
+	localChannelMention = regexp.MustCompile(`\B#([\w-]+)`)
+	localAsUser         = regexp.MustCompile(`^([\w-]+)>\s*(.*)$`)
+	discordMention      = regexp.MustCompile(`<(@!?|#)(\w[\w-]*)>`)
+)
+
+// LocalTransport plays in a terminal without discord, for trying things out and debugging.
+// Everyone shares the terminal and users and channels are just names, their ids are the names too
+type LocalTransport struct {
+	sync.Mutex
+	In  io.Reader
+	Out io.Writer
+
+	User    string
+	Channel string
+
+	views int // Number of views sent, they're named after it
+}
+
+func NewLocalTransport(in io.Reader, out io.Writer) *LocalTransport {
+	return &LocalTransport{
+		In:      in,
+		Out:     out,
+		User:    "alice",
+		Channel: "table",
+	}
+}
+
+// Prints the message with every line prefixed, so it's easy to see who it was for
+func (l *LocalTransport) print(prefix, msg string) {
+	msg = discordMention.ReplaceAllStringFunc(msg, func(m string) string {
+		parts := discordMention.FindStringSubmatch(m)
+		if parts[1] == "#" {
+			return "#" + parts[2]
+		}
+		return "@" + parts[2]
+	})
+
+	l.Lock()
+	defer l.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(msg, "\n"), "\n") {
+		fmt.Fprintf(l.Out, "%s %s\n", prefix, line)
+	}
+}
+
+func (l *LocalTransport) SendMessage(channel, msg string) {
+	l.print("[#"+channel+"]", msg)
+}
+
+func (l *LocalTransport) SendPrivateMessage(userID, msg string) {
+	l.print("[to @"+userID+"]", msg)
+}
+
+// Files can't be shown in a terminal, they're saved to LocalFilesDir instead
+func (l *LocalTransport) SendFile(channel, msg, name string, data []byte) {
+	l.print("[#"+channel+"]", msg+"\n"+l.saveFile(channel, name, data))
+}
+
+func (l *LocalTransport) SendPrivateFile(userID, msg, name string, data []byte) {
+	l.print("[to @"+userID+"]", msg+"\n"+l.saveFile(userID, name, data))
+}
+
+// Saves the file and returns where it went, prefixed with who it was for since the names repeat
+func (l *LocalTransport) saveFile(to, name string, data []byte) string {
+	err := os.MkdirAll(LocalFilesDir, 0755)
+	if err != nil {
+		return "(failed saving " + name + ": " + err.Error() + ")"
+	}
+
+	path := filepath.Join(LocalFilesDir, to+"-"+name)
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return "(failed saving " + name + ": " + err.Error() + ")"
+	}
+	return "(" + name + " saved to " + path + ")"
+}
+
+// There's nothing to press in a terminal, so just show what can be typed
+func (l *LocalTransport) SendControls(channel, msg string, controls []*Control) {
+	l.print("[#"+channel+"]", msg+"\n"+localControls(controls))
+}
+
+func localControls(controls []*Control) string {
+	commands := make([]string, len(controls))
+	for k, c := range controls {
+		commands[k] = c.Emoji + " `" + c.Command + "`"
+	}
+	return strings.Join(commands, "  ")
+}
+
+// Views can't be edited in a terminal, every change is printed again instead
+func (l *LocalTransport) SendView(channel string, view *View, controls []*Control) string {
+	l.Lock()
+	l.views++
+	id := fmt.Sprintf("view-%d", l.views)
+	l.Unlock()
+
+	l.EditView(channel, id, view, controls)
+	return id
+}
+
+func (l *LocalTransport) EditView(channel, viewID string, view *View, controls []*Control) {
+	l.print("[#"+channel+" "+viewID+"]", view.String()+localControls(controls))
+}
+
+func (l *LocalTransport) UserName(userID string) string {
+	return userID
+}
+
+func (l *LocalTransport) GuildID(channel string) string {
+	return LocalGuild
+}
+
+// Everyone is an admin locally
+func (l *LocalTransport) IsAdmin(userID, channel string) bool {
+	return true
+}
+
+// Run reads lines from In until it ends or :quit is typed
+func (l *LocalTransport) Run(handler func(m *IncomingMessage)) error {
+	l.print("*", localHelp)
+
+	scanner := bufio.NewScanner(l.In)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			fields := append(strings.Fields(line[1:]), "")
+			switch fields[0] {
+			case "user", "as", "channel", "in":
+				if fields[1] == "" {
+					l.print("*", "Missing name")
+					continue
+				}
+				l.Lock()
+				if fields[0] == "user" || fields[0] == "as" {
+					l.User = strings.TrimPrefix(fields[1], "@")
+				} else {
+					l.Channel = strings.TrimPrefix(fields[1], "#")
+				}
+				status := "Now @" + l.User + " in #" + l.Channel
+				l.Unlock()
+				l.print("*", status)
+			case "help":
+				l.print("*", localHelp)
+			case "quit", "exit":
+				return nil
+			default:
+				l.print("*", "Unknown command, type :help")
+			}
+			continue
+		}
+
+		l.Lock()
+		user := l.User
+		channel := l.Channel
+		l.Unlock()
+
+		if parts := localAsUser.FindStringSubmatch(line); parts != nil {
+			user = parts[1]
+			line = parts[2]
+		}
+
+		handler(&IncomingMessage{
+			ChannelID:  channel,
+			AuthorID:   user,
+			AuthorName: user,
+			Content:    line,
+		})
+	}
+	return scanner.Err()
+}
+
+var localMessageCounter int
+
+// Converts the message into what the command system expects, @name and #name are turned into mentions
+func LocalMessageCreate(m *IncomingMessage) *discordgo.MessageCreate {
+	localMessageCounter++
+
+	mentions := make([]*discordgo.User, 0)
+	content := localUserMention.ReplaceAllStringFunc(m.Content, func(s string) string {
+		name := s[1:]
+		mentions = append(mentions, &discordgo.User{ID: name, Username: name})
+		return "<@" + name + ">"
+	})
+	content = localChannelMention.ReplaceAllString(content, "<#$1>")
+
+	return &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        fmt.Sprint(localMessageCounter),
+			ChannelID: m.ChannelID,
+			Content:   content,
+			Author:    &discordgo.User{ID: m.AuthorID, Username: m.AuthorName},
+			Mentions:  mentions,
+		},
+	}
+}
+
+// Points the files that weren't set explicitly at local ones, so playing locally doesn't touch the real players and tables
+func UseLocalFiles() {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	paths := map[string]*string{
+		"ledger":    &flagLedger,
+		"hands":     &flagHands,
+		"economies": &flagEconomies,
+	}
+	for name, path := range paths {
+		if !set[name] {
+			*path = LocalPrefix + *path
+		}
+	}
+	TablesFile = LocalPrefix + TablesFile
+}
+
+// Sets up a discord session that's never opened with the commands registered, it only holds the state the command system looks at
+func NewOfflineSession() (*discordgo.Session, error) {
+	session, err := discordgo.New("")
+	if err != nil {
+		return nil, err
+	}
+	session.State.User = &discordgo.User{ID: LocalBotID, Username: "PokerMan", Bot: true}
+	err = session.State.GuildAdd(&discordgo.Guild{ID: LocalGuild, Name: "local"})
+	if err != nil {
+		return nil, err
+	}
+	dgo = session
+
+	cmdSystem = commandsystem.NewSystem(session, "")
+	cmdSystem.RegisterCommands(Commands...)
+	return session, nil
+}
+
+// Passes the message on to the tablemanager and the commands, like discord would
+func HandleOfflineMessage(session *discordgo.Session, m *IncomingMessage) {
+	if _, err := session.State.Channel(m.ChannelID); err != nil {
+		session.State.ChannelAdd(&discordgo.Channel{ID: m.ChannelID, GuildID: LocalGuild, Name: m.ChannelID})
+	}
+
+	tableManager.HandleMessage(m)
+	cmdSystem.HandleMessageCreate(session, LocalMessageCreate(m))
+}
+
+// RunLocal plays in the terminal until the input ends, messages go through the same commands and
+// action parser as on discord
+func RunLocal() error {
+	session, err := NewOfflineSession()
+	if err != nil {
+		return err
+	}
+
+	transport := NewLocalTransport(os.Stdin, os.Stdout)
+	tableManager.Transport = transport
+
+	go tableManager.Run()
+	go playerManager.Run()
+	go RunAuditor(time.Minute * 5)
+
+	return transport.Run(func(m *IncomingMessage) {
+		HandleOfflineMessage(session, m)
+	})
+}
@@ -1,27 +1,43 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/dutil/commandsystem"
 	"log"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	VERSION = "PokerMan 0.6 Alpha"
+
+	DebugAddr = "localhost:6060"
 )
 
 var (
-	flagToken string
-	flagDebug bool
+	flagToken     string
+	flagDebug     bool
+	flagStore     string
+	flagStorePath string
+	flagImport    string
+	flagLedger    string
+	flagHands     string
+	flagEconomies string
+	flagCheck     bool
+	flagOwner     string
+	flagLocal     bool
 
 	dgo       *discordgo.Session
 	cmdSystem *commandsystem.System
+	economies *Economies
 
 	tableManager = &TableManager{
 		tables:  make([]*Table, 0),
@@ -36,10 +52,15 @@ var (
 func init() {
 	flag.StringVar(&flagToken, "t", "", "Token to use")
 	flag.BoolVar(&flagDebug, "d", false, "Set to turn on debug info, such as pprof http server")
-
-	if !flag.Parsed() {
-		flag.Parse()
-	}
+	flag.StringVar(&flagStore, "store", "bolt", "Player store to use, bolt or json")
+	flag.StringVar(&flagStorePath, "storepath", "", "Path to the player store, defaults to players.db for bolt and players.json for json")
+	flag.StringVar(&flagImport, "import", "", "Import players from a players.json file into the player store and exit")
+	flag.StringVar(&flagLedger, "ledger", "ledger.log", "Path to the money ledger")
+	flag.StringVar(&flagHands, "hands", "hands.log", "Path to the hand history log")
+	flag.StringVar(&flagEconomies, "economies", "economies.json", "Path to the file keeping track of which guilds have their own economy")
+	flag.BoolVar(&flagCheck, "checkledger", false, "Replay the ledger, compare it against the player store and exit")
+	flag.StringVar(&flagOwner, "owner", "", "User id of the bot owner, gets alerted if money goes missing")
+	flag.BoolVar(&flagLocal, "local", false, "Play in the terminal without discord, with local- prefixed files unless their paths are set")
 }
 
 func PanicErr(err error) {
@@ -49,17 +70,78 @@ func PanicErr(err error) {
 }
 
 func main() {
+	flag.Parse()
 	log.Println("Launching " + VERSION)
 
+	if flagLocal {
+		UseLocalFiles()
+	}
+
+	storePath := flagStorePath
+	if storePath == "" {
+		storePath = "players.db"
+		if flagStore == "json" {
+			storePath = "players.json"
+		}
+		if flagLocal {
+			storePath = LocalPrefix + storePath
+		}
+	}
+
+	store, err := OpenPlayerStore(flagStore, storePath)
+	PanicErr(err)
+	playerManager.Store = store
+
+	if flagImport != "" {
+		n, err := ImportPlayersJSON(flagImport, store)
+		PanicErr(err)
+		PanicErr(store.Close())
+		log.Printf("Imported %d players from %s into %s", n, flagImport, storePath)
+		return
+	}
+
+	ledger, err := OpenLedger(flagLedger)
+	PanicErr(err)
+	playerManager.Ledger = ledger
+
+	if flagCheck {
+		CheckLedger()
+		return
+	}
+
+	economies, err = LoadEconomies(flagEconomies)
+	PanicErr(err)
+
+	handLog, err := OpenHandLog(flagHands)
+	PanicErr(err)
+	tableManager.HandLog = handLog
+
+	// Before anything can touch a player, otherwise they'd get a new one saved over what's stored
+	PanicErr(playerManager.Load())
+
+	if flagLocal {
+		ListenSignals()
+		PanicErr(RunLocal())
+		Shutdown()
+	}
+
 	session, err := discordgo.New(flagToken)
 	PanicErr(err)
 
 	cmdSystem = commandsystem.NewSystem(session, "")
 	cmdSystem.RegisterCommands(Commands...)
 
-	session.AddHandler(HandleMessageCreate)
+	transport := &DiscordTransport{Session: session, Outbox: NewOutbox(session)}
+	tableManager.Transport = transport
+	expvar.Publish("outbox_channels", expvar.Func(func() interface{} { return transport.Outbox.Depths() }))
+	if flagDebug {
+		go RunDebugServer()
+	}
+	PanicErr(transport.Run(tableManager.HandleMessage))
+
 	session.AddHandler(HandleReady)
 	session.AddHandler(HandleServerJoin)
+	session.AddHandler(HandleInteraction)
 
 	err = session.Open()
 	PanicErr(err)
@@ -68,16 +150,35 @@ func main() {
 
 	go tableManager.Run()
 	go playerManager.Run()
+	go RunAuditor(time.Minute * 5)
+
+	ListenSignals()
 
+	select {}
+}
+
+// Serves pprof and the expvar counters like the outbox queue depth on /debug/vars
+func RunDebugServer() {
+	log.Println("Debug server listening on", DebugAddr)
+	err := http.ListenAndServe(DebugAddr, nil)
+	if err != nil {
+		log.Println("Failed running debug server:", err)
+	}
+}
+
+func ListenSignals() {
 	signalChan := make(chan os.Signal)
 	go HandleSignal(signalChan)
 	signal.Notify(signalChan, os.Kill, os.Interrupt)
-
-	select {}
 }
 
 func HandleSignal(stopchan chan os.Signal) {
 	<-stopchan
+	Shutdown()
+}
+
+// Stops the tables, saves everything and exits
+func Shutdown() {
 	var wg sync.WaitGroup
 
 	// Stop tables first
@@ -85,6 +186,7 @@ func HandleSignal(stopchan chan os.Signal) {
 	wg.Add(1)
 	tableManager.EvtChan <- &StopEvt{wg: &wg}
 	wg.Wait()
+	tableManager.HandLog.Close()
 
 	// Sleep for a second to allow modifying moneis
 	time.Sleep(time.Second)
@@ -98,40 +200,54 @@ func HandleSignal(stopchan chan os.Signal) {
 	os.Exit(0)
 }
 
+// Replays the ledger and logs every player whose stored balance doesn't match
+func CheckLedger() {
+	PanicErr(playerManager.Load())
+
+	mismatches, err := playerManager.Ledger.Check(playerManager.Players)
+	PanicErr(err)
+
+	for _, v := range mismatches {
+		log.Println(v)
+	}
+	log.Printf("Checked ledger against %d players, %d mismatches", len(playerManager.Players), len(mismatches))
+}
+
 func HandleReady(s *discordgo.Session, r *discordgo.Ready) {
 	log.Println("Ready received! Connected to", len(s.State.Guilds), "Guilds")
+	go SyncSlashCommands(s)
 }
 
 func HandleServerJoin(s *discordgo.Session, g *discordgo.GuildCreate) {
 	log.Println("Joined guild", g.Name, " Connected to", len(s.State.Guilds), "Guilds")
 }
 
-func HandleMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	action := GetAction(m.Content)
-	if action != nil {
-		log.Println("Got action mon")
-		// An action lets pass it to tablemanager
-		tableManager.EvtChan <- &ActionEvt{Action: action, Channel: m.ChannelID, PlayerID: m.Author.ID}
-	}
-}
-
-// Will retry up to 5 times on 502's
-func SurelySend(channel, msg string) {
-	sendDiscordMessageRetry(channel, msg, 0, 5)
-}
-
-func sendDiscordMessageRetry(channel, msg string, counter int, max int) {
-	_, err := dgo.ChannelMessageSend(channel, msg)
-	if err != nil {
-		if strings.Contains(err.Error(), "502") {
-			if counter < max {
-				log.Println("Retrying sending message")
-				sendDiscordMessageRetry(channel, msg, counter+1, max)
-			} else {
-				log.Println("No more retries left :(")
+// Splits a message into chunks discord accepts, splitting at newlines
+func SplitMessage(msg string, max int) []string {
+	out := make([]string, 0)
+	current := ""
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		for len(line) > max {
+			// Cut before the character that doesn't fit instead of through it
+			cut := max
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = max
 			}
-		} else {
-			log.Println("Failed sending message:", err)
+			out = append(out, line[:cut])
+			line = line[cut:]
 		}
+
+		if len(current)+len(line) > max {
+			out = append(out, current)
+			current = ""
+		}
+		current += line
+	}
+	if current != "" {
+		out = append(out, current)
 	}
+	return out
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	msg := strings.Repeat("A♠️", 10) + "\n" + "short"
+	parts := SplitMessage(msg, 8)
+	if strings.Join(parts, "") != msg {
+		t.Fatalf("Expected the parts to add up to the message, got %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 8 || !utf8.ValidString(p) {
+			t.Errorf("Expected parts of at most 8 bytes cut between characters, got %q", p)
+		}
+	}
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jonas747/joker/table"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MTTSeats          = 9
+	DefaultMTTLateReg = 20 * time.Minute
+)
+
+type CreateMTTEvt struct {
+	PlayerID string
+	Name     string
+	Channel  string // Lobby channel
+	BuyIn    int
+	Channels []string // Channels to play in
+}
+
+type MTTRegisterEvt struct {
+	PlayerID   string
+	Name       string
+	Channel    string
+	Unregister bool
+}
+
+type MTTStartEvt struct {
+	PlayerID string
+	Channel  string
+}
+
+type MTTInfoEvt struct {
+	Channel string
+}
+
+// Sent by tables between hands and when they stop, lets the coordinator move players around
+type MTTUpdateEvt struct {
+	MTT *MultiTableTournament
+}
+
+// A tournament played over several channels, the coordinator spreads players over the tables,
+// breaks and balances them as players bust and moves everyone to a final table in the end.
+// Registration happens in the lobby channel where the results are also posted.
+type MultiTableTournament struct {
+	sync.Mutex
+
+	Lobby    string
+	Creator  string
+	BuyIn    int
+	Channels []string // Channels that can be used for tables
+	Stack    int
+	LateReg  time.Duration // How long after the start people can still register
+	Pool     int
+	Bank     string
+
+	Registered []*TournamentEntrant
+	Waiting    []*TournamentEntrant // Registered but not seated yet, from late registration
+	Eliminated []*TournamentEntrant // In the order they got knocked out
+
+	Started   bool
+	StartedAt time.Time
+	Tables    []*Table
+
+	finished   bool
+	finalTable bool
+	chopped    map[string]int // Chips players had when the tournament got cut short
+}
+
+// Default prize structures, bigger fields pays more places
+func DefaultMTTPrizes(entrants int) []int {
+	switch {
+	case entrants <= 10:
+		return []int{50, 30, 20}
+	case entrants <= 20:
+		return []int{40, 25, 15, 12, 8}
+	default:
+		return []int{30, 20, 14, 10, 8, 7, 6, 5}
+	}
+}
+
+// Players still in the tournament
+func (m *MultiTableTournament) MoneySource(reason string) MoneySource {
+	return MoneySource{Reason: reason, Channel: m.Lobby, Bank: m.Bank}
+}
+
+func (m *MultiTableTournament) Remaining() int {
+	return len(m.Registered) - len(m.Eliminated)
+}
+
+func (m *MultiTableTournament) LateRegOpen() bool {
+	return !m.Started || time.Since(m.StartedAt) < m.LateReg
+}
+
+func (m *MultiTableTournament) String() string {
+	m.Lock()
+	defer m.Unlock()
+
+	status := "Registering"
+	if m.Started {
+		status = fmt.Sprintf("Running, %d of %d players left", m.Remaining(), len(m.Registered))
+		if m.LateRegOpen() {
+			status += fmt.Sprintf(", late registration open for %d more minutes", int((m.LateReg - time.Since(m.StartedAt)).Minutes()))
+		}
+	}
+
+	channels := make([]string, len(m.Channels))
+	for k, v := range m.Channels {
+		channels[k] = "<#" + v + ">"
+	}
+
+	return fmt.Sprintf("Multi table tournament:\n - Status: **%s**\n - Buy in: **$%d**\n - Prize pool: **$%d**\n - Registered: **%d**\n - Starting stack: **%d**\n - Tables: %s\n",
+		status, m.BuyIn, m.Pool, len(m.Registered), m.Stack, strings.Join(channels, ", "))
+}
+
+// Knocks a player out, called by the table he was at
+func (m *MultiTableTournament) Eliminate(entrant *TournamentEntrant) int {
+	m.Lock()
+	defer m.Unlock()
+
+	m.Eliminated = append(m.Eliminated, entrant)
+	return m.Remaining() + 1
+}
+
+func (t *TableManager) GetMTT(lobby string) *MultiTableTournament {
+	for _, v := range t.mtts {
+		if v.Lobby == lobby {
+			return v
+		}
+	}
+	return nil
+}
+
+func (t *TableManager) requireMTT(lobby string) *MultiTableTournament {
+	mtt := t.GetMTT(lobby)
+	if mtt == nil {
+		t.Send(lobby, "No multi table tournament in this channel")
+	}
+	return mtt
+}
+
+func (t *TableManager) CreateMTT(evt *CreateMTTEvt) {
+	if t.GetMTT(evt.Channel) != nil {
+		t.Send(evt.Channel, "There's already a tournament in this channel")
+		return
+	}
+
+	if len(evt.Channels) < 1 {
+		t.Send(evt.Channel, "Mention the channels to play in, like `mtt create 100 #table-1 #table-2`")
+		return
+	}
+
+	if evt.BuyIn < 1 {
+		t.Send(evt.Channel, "Buy in has to be atleast $1")
+		return
+	}
+
+	for _, channel := range evt.Channels {
+		if t.GetTable(channel) != nil {
+			t.Send(evt.Channel, "There's already a table in <#"+channel+">")
+			return
+		}
+	}
+
+	mtt := &MultiTableTournament{
+		Lobby:    evt.Channel,
+		Creator:  evt.PlayerID,
+		BuyIn:    evt.BuyIn,
+		Channels: evt.Channels,
+		Stack:    DefaultTournamentStack,
+		LateReg:  DefaultMTTLateReg,
+		Bank:     economies.BankFor(t.Transport.GuildID(evt.Channel)),
+	}
+	t.mtts = append(t.mtts, mtt)
+
+	t.Send(evt.Channel, fmt.Sprintf("Created a multi table tournament with a $%d buy in over %d tables, register with `mtt register`", evt.BuyIn, len(evt.Channels)))
+}
+
+func (t *TableManager) RegisterMTT(evt *MTTRegisterEvt) {
+	mtt := t.requireMTT(evt.Channel)
+	if mtt == nil {
+		return
+	}
+
+	if evt.Unregister {
+		t.unregisterMTT(mtt, evt)
+		return
+	}
+
+	mtt.Lock()
+	defer mtt.Unlock()
+
+	if !mtt.LateRegOpen() || mtt.finished {
+		t.Send(evt.Channel, "Registration is closed")
+		return
+	}
+
+	for _, v := range mtt.Registered {
+		if v.ID == evt.PlayerID {
+			t.Send(evt.Channel, "You're already registered")
+			return
+		}
+	}
+
+	if len(mtt.Registered)-len(mtt.Eliminated) >= len(mtt.Channels)*MTTSeats {
+		t.Send(evt.Channel, "The tournament is full")
+		return
+	}
+
+	if !TakeMoney(evt.PlayerID, evt.Name, mtt.BuyIn, mtt.MoneySource(ReasonBuyIn)) {
+		t.Send(evt.Channel, fmt.Sprintf("Not enough money to register, the buy in is $%d", mtt.BuyIn))
+		return
+	}
+
+	entrant := &TournamentEntrant{ID: evt.PlayerID, Name: evt.Name}
+	mtt.Registered = append(mtt.Registered, entrant)
+	mtt.Pool += mtt.BuyIn
+	t.Send(evt.Channel, fmt.Sprintf("%s registered (%d players)", evt.Name, len(mtt.Registered)))
+
+	if mtt.Started {
+		mtt.Waiting = append(mtt.Waiting, entrant)
+		go func() {
+			t.EvtChan <- &MTTUpdateEvt{MTT: mtt}
+		}()
+	}
+}
+
+func (t *TableManager) unregisterMTT(mtt *MultiTableTournament, evt *MTTRegisterEvt) {
+	mtt.Lock()
+	defer mtt.Unlock()
+
+	if mtt.Started {
+		t.Send(evt.Channel, "The tournament has already started, use `leave` at your table to forfeit")
+		return
+	}
+
+	for k, v := range mtt.Registered {
+		if v.ID == evt.PlayerID {
+			mtt.Registered = append(mtt.Registered[:k], mtt.Registered[k+1:]...)
+			mtt.Pool -= mtt.BuyIn
+			GiveMoney(v.ID, v.Name, mtt.BuyIn, mtt.MoneySource(ReasonRefund))
+			t.Send(evt.Channel, v.Name+" unregistered")
+			return
+		}
+	}
+
+	t.Send(evt.Channel, "You're not registered")
+}
+
+func (t *TableManager) StartMTT(evt *MTTStartEvt) {
+	mtt := t.requireMTT(evt.Channel)
+	if mtt == nil {
+		return
+	}
+
+	mtt.Lock()
+	if mtt.Creator != evt.PlayerID {
+		mtt.Unlock()
+		t.Send(evt.Channel, "Only the creator of the tournament can start it")
+		return
+	}
+
+	if mtt.Started {
+		mtt.Unlock()
+		t.Send(evt.Channel, "Already started")
+		return
+	}
+
+	if len(mtt.Registered) < 2 {
+		mtt.Unlock()
+		t.Send(evt.Channel, "Need atleast 2 players to start")
+		return
+	}
+
+	for _, channel := range mtt.Channels {
+		if t.GetTable(channel) != nil {
+			mtt.Unlock()
+			t.Send(evt.Channel, "There's a table in <#"+channel+">, it has to be gone before the tournament can start")
+			return
+		}
+	}
+
+	mtt.Started = true
+	mtt.StartedAt = time.Now()
+	mtt.Unlock()
+
+	// Use as few tables as possible
+	numTables := (len(mtt.Registered) + MTTSeats - 1) / MTTSeats
+	for i := 0; i < numTables; i++ {
+		mtt.Tables = append(mtt.Tables, t.newMTTTable(mtt, mtt.Channels[i]))
+	}
+
+	for k, entrant := range mtt.Registered {
+		tbl := mtt.Tables[k%numTables]
+		tbl.Lock()
+		seatEntrant(tbl, entrant, mtt.Stack)
+		tbl.Unlock()
+	}
+
+	// Check if it's over when late registration closes, incase nothing else happens by then
+	time.AfterFunc(mtt.LateReg, func() {
+		t.EvtChan <- &MTTUpdateEvt{MTT: mtt}
+	})
+
+	t.Send(evt.Channel, fmt.Sprintf("The tournament has started with %d players, prize pool is $%d. Late registration is open for %d minutes",
+		len(mtt.Registered), mtt.Pool, int(mtt.LateReg.Minutes())))
+	t.BalanceMTT(mtt)
+}
+
+func (t *TableManager) newMTTTable(mtt *MultiTableTournament, channel string) *Table {
+	opts := table.Config{
+		Game:       table.Holdem,
+		Limit:      table.NoLimit,
+		Stakes:     table.Stakes{SmallBet: 10, BigBet: 20, Ante: 0},
+		NumOfSeats: MTTSeats,
+	}
+
+	// Nobody owns the tables, the tournament runs them
+	tbl := t.NewTable(channel, "", "the tournament", opts)
+	tbl.MTT = mtt
+	tbl.Blinds, _ = ParseBlindSchedule("standard", opts.Stakes.SmallBet)
+	t.tables = append(t.tables, tbl)
+	return tbl
+}
+
+// Seats the entrant at the first free seat, the table should be locked
+func seatEntrant(tbl *Table, entrant *TournamentEntrant, chips int) bool {
+	tp := &TablePlayer{
+		Id:    entrant.ID,
+		Name:  entrant.Name,
+		Table: tbl,
+	}
+
+	for i := 0; i < tbl.Table.NumOfSeats(); i++ {
+		if tbl.Sit(tp, i, chips) == nil {
+			tbl.Send(fmt.Sprintf("**%s** sat down with %d chips", entrant.Name, chips))
+			tbl.CheckReplaceOwner()
+			return true
+		}
+	}
+	return false
+}
+
+// Moves a player between tables in the same tournament, both tables should be locked and between hands
+func movePlayer(from, to *Table, p *table.PlayerState) bool {
+	if len(to.Table.Players()) >= to.Table.NumOfSeats() {
+		return false
+	}
+
+	tablePlayer := asTablePlayer(p.Player())
+	entrant := &TournamentEntrant{ID: tablePlayer.Id, Name: tablePlayer.Name}
+	chips := from.Stand(p)
+	from.CheckReplaceOwner()
+
+	if !seatEntrant(to, entrant, chips) {
+		// Should never happen since we checked for a free seat, put him back where he was
+		seatEntrant(from, entrant, chips)
+		return false
+	}
+
+	from.Send(fmt.Sprintf("**%s** was moved to <#%s>", entrant.Name, to.Channel))
+	return true
+}
+
+// BalanceMTT seats late registrations, breaks tables that are no longer needed and keeps table sizes within one player of each other.
+// Only tables between hands are touched, the rest will be handled the next time they finish a hand.
+//
+// Tables lock the tournament while holding their own lock when someone busts, so the tables are locked before the tournament here.
+// Only the tablemanager touches the tables and registration lists so those are safe to look at before locking.
+func (t *TableManager) BalanceMTT(mtt *MultiTableTournament) {
+	if mtt.finished || !mtt.Started || t.stopping {
+		return
+	}
+
+	// Drop tables that are gone
+	live := make([]*Table, 0, len(mtt.Tables))
+	for _, tbl := range mtt.Tables {
+		if t.GetTable(tbl.Channel) == tbl {
+			live = append(live, tbl)
+		}
+	}
+	mtt.Tables = live
+
+	for _, tbl := range mtt.Tables {
+		tbl.Lock()
+	}
+	mtt.Lock()
+	defer mtt.Unlock()
+
+	lastOneStanding := mtt.Remaining() < 2 && len(mtt.Waiting) < 1 && !mtt.LateRegOpen()
+	if lastOneStanding || mtt.Remaining() < 1 {
+		t.finishMTT(mtt)
+		return
+	}
+
+	t.seatWaiting(mtt)
+	t.breakTables(mtt)
+	balanceTables(mtt)
+
+	remaining := make([]*Table, 0, len(mtt.Tables))
+	for _, tbl := range mtt.Tables {
+		players := len(tbl.Table.Players())
+		if players < 1 {
+			tbl.stopAfterDone = true
+			t.RemoveTable(tbl.Channel)
+		} else {
+			if players >= 2 && !tbl.Running {
+				tbl.Start()
+			}
+			remaining = append(remaining, tbl)
+		}
+		tbl.Unlock()
+	}
+	mtt.Tables = remaining
+
+	if len(mtt.Tables) == 1 && len(mtt.Waiting) < 1 && mtt.Remaining() > 1 && !mtt.finalTable {
+		mtt.finalTable = true
+		t.Send(mtt.Lobby, fmt.Sprintf("Final table! %d players left in <#%s>", mtt.Remaining(), mtt.Tables[0].Channel))
+	}
+}
+
+// Seats players from late registration, opens new tables if needed
+func (t *TableManager) seatWaiting(mtt *MultiTableTournament) {
+	for len(mtt.Waiting) > 0 {
+		var target *Table
+		for _, tbl := range mtt.Tables {
+			if tbl.inHand || len(tbl.Table.Players()) >= MTTSeats {
+				continue
+			}
+			if target == nil || len(tbl.Table.Players()) < len(target.Table.Players()) {
+				target = tbl
+			}
+		}
+
+		if target == nil {
+			channel := ""
+			for _, c := range mtt.Channels {
+				if t.GetTable(c) == nil {
+					channel = c
+					break
+				}
+			}
+			if channel == "" {
+				return
+			}
+
+			target = t.newMTTTable(mtt, channel)
+			target.Lock()
+			mtt.Tables = append(mtt.Tables, target)
+		}
+
+		if !seatEntrant(target, mtt.Waiting[0], mtt.Stack) {
+			return
+		}
+		mtt.Waiting = mtt.Waiting[1:]
+	}
+}
+
+// Breaks the smallest table if everyone fits at the other ones
+func (t *TableManager) breakTables(mtt *MultiTableTournament) {
+	for len(mtt.Tables) > 1 {
+		seated := 0
+		for _, tbl := range mtt.Tables {
+			seated += len(tbl.Table.Players())
+		}
+		if seated > (len(mtt.Tables)-1)*MTTSeats {
+			return
+		}
+
+		sort.Sort(tablesBySize(mtt.Tables))
+		breaking := mtt.Tables[0]
+		if breaking.inHand {
+			return
+		}
+
+		for seat := 0; seat < breaking.Table.NumOfSeats(); seat++ {
+			p, ok := breaking.Table.Players()[seat]
+			if !ok {
+				continue
+			}
+
+			for _, to := range mtt.Tables[1:] {
+				if !to.inHand && movePlayer(breaking, to, p) {
+					break
+				}
+			}
+		}
+
+		if len(breaking.Table.Players()) > 0 {
+			// Couldn't move everyone yet
+			return
+		}
+
+		breaking.stopAfterDone = true
+		t.Send(breaking.Channel, "This table is broken, thanks for playing here")
+		t.Send(mtt.Lobby, fmt.Sprintf("Table <#%s> was broken, %d tables left", breaking.Channel, len(mtt.Tables)-1))
+		t.RemoveTable(breaking.Channel)
+		breaking.Unlock()
+		mtt.Tables = mtt.Tables[1:]
+	}
+}
+
+// Moves players from the biggest tables to the smallest until they're within one player of each other
+func balanceTables(mtt *MultiTableTournament) {
+	for len(mtt.Tables) > 1 {
+		sort.Sort(tablesBySize(mtt.Tables))
+		smallest := mtt.Tables[0]
+		biggest := mtt.Tables[len(mtt.Tables)-1]
+
+		if len(biggest.Table.Players())-len(smallest.Table.Players()) < 2 || biggest.inHand || smallest.inHand {
+			return
+		}
+
+		moved := false
+		for seat := 0; seat < biggest.Table.NumOfSeats(); seat++ {
+			p, ok := biggest.Table.Players()[seat]
+			if ok {
+				moved = movePlayer(biggest, smallest, p)
+				break
+			}
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+type tablesBySize []*Table
+
+func (t tablesBySize) Len() int      { return len(t) }
+func (t tablesBySize) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t tablesBySize) Less(i, j int) bool {
+	return len(t[i].Table.Players()) < len(t[j].Table.Players())
+}
+
+// Pays out the prize pool and unlocks the tables, mtt and its tables should be locked
+func (t *TableManager) finishMTT(mtt *MultiTableTournament) {
+	mtt.finished = true
+
+	places := make([]*TournamentEntrant, 0)
+	for _, tbl := range mtt.Tables {
+		for _, p := range tbl.Table.Players() {
+			tablePlayer := asTablePlayer(p.Player())
+			places = append(places, &TournamentEntrant{ID: tablePlayer.Id, Name: tablePlayer.Name})
+		}
+	}
+	for i := len(mtt.Eliminated) - 1; i >= 0; i-- {
+		places = append(places, mtt.Eliminated[i])
+	}
+
+	prizes := DefaultMTTPrizes(len(mtt.Registered))
+	paid := make([]int, len(places))
+	pool := mtt.Pool
+	for i := len(prizes) - 1; i >= 0; i-- {
+		if i >= len(places) {
+			continue
+		}
+
+		prize := pool * prizes[i] / 100
+		if i == 0 {
+			prize = mtt.Pool
+		}
+		paid[i] = prize
+		mtt.Pool -= prize
+	}
+
+	out := ""
+	for i, entrant := range places {
+		if paid[i] < 1 {
+			break
+		}
+		GiveMoney(entrant.ID, entrant.Name, paid[i], mtt.MoneySource(ReasonPrize))
+		out += fmt.Sprintf("%s: **%s** $%d\n", ordinal(i+1), entrant.Name, paid[i])
+	}
+
+	t.Send(mtt.Lobby, "The tournament is over!\n"+out)
+
+	for _, tbl := range mtt.Tables {
+		tbl.stopAfterDone = true
+		t.Send(tbl.Channel, "The tournament is over, results are in <#"+mtt.Lobby+">")
+		t.RemoveTable(tbl.Channel)
+		tbl.Unlock()
+	}
+	mtt.Tables = nil
+	t.removeMTT(mtt)
+}
+
+func (t *TableManager) removeMTT(mtt *MultiTableTournament) {
+	for k, v := range t.mtts {
+		if v == mtt {
+			t.mtts = append(t.mtts[:k], t.mtts[k+1:]...)
+			return
+		}
+	}
+}
+
+// Records the chips of a player when the tournament is cut short by a shutdown, the table should be locked
+func (m *MultiTableTournament) RecordChop(tbl *Table) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.chopped == nil {
+		m.chopped = make(map[string]int)
+	}
+
+	for _, p := range tbl.Table.Players() {
+		tablePlayer := asTablePlayer(p.Player())
+		m.chopped[tablePlayer.Id] += p.Chips()
+	}
+}
+
+// Called on shutdown, tournaments that haven't started are refunded and running ones
+// have their prize pool split by how many chips everyone has left
+func (t *TableManager) ChopMTTs() {
+	for _, mtt := range t.mtts {
+		mtt.Lock()
+
+		if !mtt.Started {
+			for _, v := range mtt.Registered {
+				GiveMoney(v.ID, v.Name, mtt.BuyIn, mtt.MoneySource(ReasonRefund))
+			}
+			mtt.Pool = 0
+			mtt.Unlock()
+			continue
+		}
+
+		if mtt.chopped == nil {
+			mtt.chopped = make(map[string]int)
+		}
+		for _, v := range mtt.Waiting {
+			mtt.chopped[v.ID] += mtt.Stack
+		}
+
+		total := 0
+		for _, chips := range mtt.chopped {
+			total += chips
+		}
+
+		// Shares are rounded down, the chip leader gets what's left over like the winner does when it finishes
+		pool := mtt.Pool
+		shares := make(map[string]int)
+		var leader *TournamentEntrant
+		for _, v := range mtt.Registered {
+			chips, ok := mtt.chopped[v.ID]
+			if !ok || chips < 1 || total < 1 {
+				continue
+			}
+
+			shares[v.ID] = pool * chips / total
+			mtt.Pool -= shares[v.ID]
+			if leader == nil || chips > mtt.chopped[leader.ID] {
+				leader = v
+			}
+		}
+		if leader != nil {
+			shares[leader.ID] += mtt.Pool
+			mtt.Pool = 0
+		}
+
+		out := ""
+		for _, v := range mtt.Registered {
+			share, ok := shares[v.ID]
+			if !ok {
+				continue
+			}
+			GiveMoney(v.ID, v.Name, share, mtt.MoneySource(ReasonPrize))
+			out += fmt.Sprintf("**%s**: %d chips, $%d\n", v.Name, mtt.chopped[v.ID], share)
+		}
+
+		if mtt.Pool > 0 {
+			log.Printf("$%d left in the prize pool of the tournament in %s after chopping", mtt.Pool, mtt.Lobby)
+		}
+		t.Send(mtt.Lobby, "The bot is shutting down so the tournament was cut short, the prize pool was split by chip count:\n"+out)
+		mtt.Unlock()
+	}
+	t.mtts = nil
+}
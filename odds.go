@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"log"
+	"strings"
+)
+
+const MaxOddsHands = 10
+
+// Parses hands separated by vs followed by the board, like "AhKh vs QsQd 2c7d9h".
+// 2 card hands are holdem and 4 card hands omaha
+func ParseOdds(args string) (table.Game, [][]*hand.Card, []*hand.Card, error) {
+	hands := make([][]*hand.Card, 0)
+	board := make([]*hand.Card, 0)
+
+	expectHand := true
+	for _, field := range strings.Fields(args) {
+		if strings.EqualFold(field, "vs") {
+			if expectHand {
+				return "", nil, nil, errors.New("Expected a hand before vs")
+			}
+			expectHand = true
+			continue
+		}
+
+		cards, err := ParseCards(field)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if expectHand {
+			hands = append(hands, cards)
+			expectHand = false
+		} else {
+			board = append(board, cards...)
+		}
+	}
+
+	if expectHand && len(hands) > 0 {
+		return "", nil, nil, errors.New("Expected a hand after vs")
+	}
+	if len(hands) < 2 {
+		return "", nil, nil, errors.New("Give at least 2 hands, like `odds AhKh vs QsQd` or `odds AhKh vs QsQd 2c7d9h`")
+	}
+	if len(hands) > MaxOddsHands {
+		return "", nil, nil, fmt.Errorf("Give at most %d hands", MaxOddsHands)
+	}
+
+	for _, h := range hands {
+		if len(h) != len(hands[0]) {
+			return "", nil, nil, errors.New("All hands need the same number of cards")
+		}
+	}
+
+	switch len(hands[0]) {
+	case 2:
+		return table.Holdem, hands, board, nil
+	case 4:
+		return table.OmahaHi, hands, board, nil
+	}
+	return "", nil, nil, errors.New("Hands need 2 cards for holdem or 4 for omaha")
+}
+
+// Formats the equity of every hand, labels are what to call them
+func formatEquities(game table.Game, labels []string, equities []*Equity, exact bool) string {
+	out := ""
+	for k, e := range equities {
+		out += fmt.Sprintf("%s: **%.1f%%** win, %.1f%% tie\n", labels[k], e.Win*100, e.Tie*100)
+	}
+
+	if exact {
+		out += "_Every run out was dealt"
+	} else {
+		out += fmt.Sprintf("_Estimated from %d random run outs", EquitySamples)
+	}
+	if IsHiLo(game) {
+		out += ", only counting the high hand"
+	}
+	return out + "_"
+}
+
+// Returns true if nobody can bet anymore and there are at least 2 players left in the hand, table should be locked
+func (t *Table) actionClosed() bool {
+	live, canAct := 0, 0
+	var acting *table.PlayerState
+	for _, p := range t.Table.Players() {
+		if p.Out() {
+			continue
+		}
+		live++
+		if !p.AllIn() {
+			canAct++
+			acting = p
+		}
+	}
+	if live < 2 || canAct > 1 {
+		return false
+	}
+
+	// The last one with chips still has to call the all in
+	current := t.Table.CurrentPlayer()
+	if acting != nil && current != nil && current.Seat() == acting.Seat() && t.Table.Outstanding() > 0 {
+		return false
+	}
+	return true
+}
+
+// Turns the cards face up and posts everyones chances once the action is closed, and again every street
+func (t *Table) MaybeSendOdds() {
+	if !t.inHand || !t.actionClosed() {
+		return
+	}
+
+	game := t.Table.Game()
+	holeSize, boardSize := gameCards(game)
+	board := t.Table.Board()
+	known, missing := len(board), boardSize-len(board)
+
+	labels := make([]string, 0)
+	hands := make([][]*hand.Card, 0)
+	players := t.Table.Players()
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		player, ok := players[seat]
+		if !ok || player.Out() {
+			continue
+		}
+
+		cards := make([]*hand.Card, 0)
+		for _, hc := range player.HoleCards() {
+			cards = append(cards, hc.Card)
+		}
+		known += len(cards)
+		missing += holeSize - len(cards)
+
+		labels = append(labels, fmt.Sprintf("%s %s", asTablePlayer(player.Player()).Name, cardsString(cards)))
+		hands = append(hands, cards)
+	}
+
+	// Nothing new to show, or nothing left to deal
+	if known <= t.printedOdds || missing < 1 {
+		return
+	}
+	t.printedOdds = known
+
+	// Done before the next street is dealt so the odds come in order, it's sampled when there's too much to deal
+	// out so it doesn't hold the table up for long
+	equities, exact, err := CalculateEquity(game, hands, board)
+	if err != nil {
+		log.Println("Failed calculating equity:", err)
+		return
+	}
+	t.Send("**All in**, cards up:\n" + formatEquities(game, labels, equities, exact))
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"github.com/bwmarrin/discordgo"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	MaxMessageLength = 2000 // Discord won't take longer messages
+
+	OutboxDeadline   = time.Minute * 2 // How long a message is retried before it's given up on
+	OutboxBackoff    = time.Millisecond * 500
+	OutboxMaxBackoff = time.Second * 30
+)
+
+// Counters for monitoring, served on /debug/vars with -d. Queued is what's waiting to be sent right now
+var outboxStats = expvar.NewMap("outbox")
+
+// Outbox sends messages to discord one at a time per channel so they arrive in the order they were sent.
+// Every channel has its own queue so a slow or rate limited one doesn't hold up the rest.
+//
+// Discordgo waits on the rate limit buckets from the response headers before sending, 429s that still happen
+// and server errors are retried here with exponential backoff until the deadline
+type Outbox struct {
+	sync.Mutex
+	Session  *discordgo.Session
+	Deadline time.Duration
+
+	queues map[string]*outQueue // By channel, or @user for private messages
+}
+
+type outQueue struct {
+	messages   []*outMessage
+	lastNotice time.Time // Last time the channel was told a message was lost
+}
+
+type outMessage struct {
+	Channel string
+	UserID  string // Set for private messages, the channel is looked up when it's sent
+
+	// One of these
+	Send *discordgo.MessageSend
+	Edit *discordgo.MessageEdit
+
+	// Called with the result once it's sent or given up on, from the queues goroutine so it shouldn't block
+	Done func(m *discordgo.Message, err error)
+
+	queued time.Time
+	notice bool // Tells the channel a message was lost, a lost notice doesn't get one of its own
+}
+
+// Plain text messages in a row are sent as one
+func (m *outMessage) coalescable() bool {
+	return m.Send != nil && m.Done == nil && !m.notice && len(m.Send.Files) < 1 && len(m.Send.Embeds) < 1 && m.Send.Content != ""
+}
+
+func NewOutbox(session *discordgo.Session) *Outbox {
+	return &Outbox{
+		Session:  session,
+		Deadline: OutboxDeadline,
+		queues:   make(map[string]*outQueue),
+	}
+}
+
+// Queue adds the message to the end of its channels queue, it's sent in the background
+func (o *Outbox) Queue(m *outMessage) {
+	key := m.Channel
+	if m.UserID != "" {
+		key = "@" + m.UserID
+	}
+	m.queued = time.Now()
+
+	o.Lock()
+	q, ok := o.queues[key]
+	if !ok {
+		q = &outQueue{}
+		o.queues[key] = q
+	}
+	q.messages = append(q.messages, m)
+	o.Unlock()
+
+	outboxStats.Add("queued", 1)
+	if !ok {
+		go o.run(key, q)
+	}
+}
+
+// Returns the number of messages waiting in every channel that has any
+func (o *Outbox) Depths() map[string]int {
+	o.Lock()
+	defer o.Unlock()
+
+	depths := make(map[string]int)
+	for k, q := range o.queues {
+		depths[k] = len(q.messages)
+	}
+	return depths
+}
+
+// Sends the queue until it's empty
+func (o *Outbox) run(key string, q *outQueue) {
+	for {
+		o.Lock()
+		if len(q.messages) < 1 {
+			delete(o.queues, key)
+			o.Unlock()
+			return
+		}
+
+		m, n := q.messages[0], 1
+		if m.coalescable() {
+			content := m.Send.Content
+			for n < len(q.messages) && q.messages[n].coalescable() && len(content)+1+len(q.messages[n].Send.Content) <= MaxMessageLength {
+				content += "\n" + q.messages[n].Send.Content
+				n++
+			}
+			if n > 1 {
+				m = &outMessage{Channel: m.Channel, UserID: m.UserID, Send: &discordgo.MessageSend{Content: content}, queued: m.queued}
+				outboxStats.Add("coalesced", int64(n-1))
+			}
+		}
+		q.messages = q.messages[n:]
+		o.Unlock()
+
+		outboxStats.Add("queued", -int64(n))
+		sent, err := o.deliver(q, m)
+		if m.Done != nil {
+			m.Done(sent, err)
+		}
+	}
+}
+
+// Tries sending the message until it works, can't ever work or the deadline is up
+func (o *Outbox) deliver(q *outQueue, m *outMessage) (*discordgo.Message, error) {
+	channel := m.Channel
+	for attempt := 0; ; attempt++ {
+		sent, err := o.try(m, &channel)
+		if err == nil {
+			outboxStats.Add("sent", 1)
+			return sent, nil
+		}
+
+		wait, retry := retryDelay(err, attempt)
+		if !retry {
+			outboxStats.Add("dropped", 1)
+			log.Printf("Failed sending to %s: %s", channel, err)
+			return nil, err
+		}
+
+		if time.Now().Add(wait).After(m.queued.Add(o.Deadline)) {
+			outboxStats.Add("dropped", 1)
+			o.giveUp(q, m, channel, err)
+			return nil, err
+		}
+
+		outboxStats.Add("retries", 1)
+		time.Sleep(wait)
+	}
+}
+
+// Makes one attempt, channel is filled in for private messages
+func (o *Outbox) try(m *outMessage, channel *string) (*discordgo.Message, error) {
+	if *channel == "" {
+		var err error
+		*channel, err = o.privateChannel(m.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Retries are done here, not by discordgo
+	options := []discordgo.RequestOption{discordgo.WithRetryOnRatelimit(false), discordgo.WithRestRetries(0)}
+	if m.Edit != nil {
+		return o.Session.ChannelMessageEditComplex(m.Edit, options...)
+	}
+
+	// A failed attempt might have read some of the files
+	for _, f := range m.Send.Files {
+		if seeker, ok := f.Reader.(io.Seeker); ok {
+			seeker.Seek(0, io.SeekStart)
+		}
+	}
+	return o.Session.ChannelMessageSendComplex(*channel, m.Send, options...)
+}
+
+// Returns the private channel with the user, it's created if there isn't one yet
+func (o *Outbox) privateChannel(userID string) (string, error) {
+	o.Session.State.RLock()
+	for _, channel := range o.Session.State.PrivateChannels {
+		if len(channel.Recipients) > 0 && channel.Recipients[0].ID == userID {
+			o.Session.State.RUnlock()
+			return channel.ID, nil
+		}
+	}
+	o.Session.State.RUnlock()
+
+	channel, err := o.Session.UserChannelCreate(userID)
+	if err != nil {
+		return "", err
+	}
+
+	go o.Session.State.ChannelAdd(channel)
+	return channel.ID, nil
+}
+
+// Lets the channel know something went missing, once per deadline so an outage doesn't end in a wall of these.
+// The notice goes to the front of the queue so it's sent next, and is retried like everything else
+func (o *Outbox) giveUp(q *outQueue, m *outMessage, channel string, err error) {
+	log.Printf("Gave up sending to %s after %s: %s", channel, o.Deadline, err)
+	if m.notice || time.Since(q.lastNotice) < o.Deadline {
+		return
+	}
+	q.lastNotice = time.Now()
+
+	notice := &outMessage{
+		Channel: m.Channel,
+		UserID:  m.UserID,
+		Send:    &discordgo.MessageSend{Content: "⚠️ Couldn't get a message through to discord, some of what happened here might be missing"},
+		queued:  time.Now(),
+		notice:  true,
+	}
+
+	o.Lock()
+	q.messages = append([]*outMessage{notice}, q.messages...)
+	o.Unlock()
+	outboxStats.Add("queued", 1)
+}
+
+// Returns how long to wait before the next attempt, retry is false if trying again won't help
+func retryDelay(err error, attempt int) (wait time.Duration, retry bool) {
+	backoff := OutboxMaxBackoff
+	if attempt < 16 && OutboxBackoff<<uint(attempt) < OutboxMaxBackoff {
+		backoff = OutboxBackoff << uint(attempt)
+	}
+	// Jitter so channels that hit the limit together don't all come back at once
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	var rateLimited *discordgo.RateLimitError
+	if errors.As(err, &rateLimited) {
+		if rateLimited.RetryAfter > backoff {
+			return rateLimited.RetryAfter, true
+		}
+		return backoff, true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode < 500 {
+		// Missing permissions, deleted channel and so on
+		return 0, false
+	}
+
+	// Server errors and network trouble
+	return backoff, true
+}
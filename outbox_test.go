@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	var lock sync.Mutex
+	received := make([]string, 0)
+	limited := false
+
+	// Rate limits the first message, and channel 2 can't be sent to
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/channels/2/") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code": 50013, "message": "Missing Permissions"}`))
+			return
+		}
+		if !limited {
+			limited = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.05, "global": false}`))
+			return
+		}
+
+		var msg discordgo.MessageSend
+		json.NewDecoder(r.Body).Decode(&msg)
+		received = append(received, msg.Content)
+		w.Write([]byte(`{"id": "1", "channel_id": "1"}`))
+	}))
+	defer server.Close()
+
+	endpoint := discordgo.EndpointChannels
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	defer func() { discordgo.EndpointChannels = endpoint }()
+
+	session, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(session)
+
+	// Channels are sent to independently, so the failing one doesn't wait for the rate limit
+	results := map[string]chan error{"1": make(chan error, 1), "2": make(chan error, 1)}
+	for i := 0; i < 5; i++ {
+		outbox.Queue(&outMessage{Channel: "1", Send: &discordgo.MessageSend{Content: fmt.Sprint(i)}})
+	}
+	for _, channel := range []string{"1", "2"} {
+		result := results[channel]
+		outbox.Queue(&outMessage{
+			Channel: channel,
+			Send:    &discordgo.MessageSend{Content: "last"},
+			Done:    func(m *discordgo.Message, err error) { result <- err },
+		})
+	}
+
+	for channel, result := range results {
+		select {
+		case err := <-result:
+			if (err == nil) != (channel == "1") {
+				t.Errorf("Expected only the message to channel 1 to get through, channel %s got %v", channel, err)
+			}
+		case <-time.After(expectTimeout):
+			t.Fatal("Timed out waiting for the outbox")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if joined := strings.Join(received, "\n"); joined != "0\n1\n2\n3\n4\nlast" {
+		t.Errorf("Expected the messages in order, got %q", joined)
+	}
+	if len(received) > 3 {
+		t.Errorf("Expected the messages queued behind the rate limit to be sent together, got %d messages", len(received))
+	}
+	if queued := outboxStats.Get("queued").String(); queued != "0" {
+		t.Errorf("Expected nothing to be queued, got %s", queued)
+	}
+}
+
+func TestOutboxNotice(t *testing.T) {
+	var lock sync.Mutex
+	received := make([]string, 0)
+
+	// Discord is down for everything but the notice
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg discordgo.MessageSend
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(msg.Content, "Couldn't get a message through") {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"message": "Bad gateway"}`))
+			return
+		}
+
+		lock.Lock()
+		received = append(received, msg.Content)
+		lock.Unlock()
+		w.Write([]byte(`{"id": "1", "channel_id": "1"}`))
+	}))
+	defer server.Close()
+
+	endpoint := discordgo.EndpointChannels
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	defer func() { discordgo.EndpointChannels = endpoint }()
+
+	session, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(session)
+	outbox.Deadline = time.Millisecond * 300
+
+	// Both are given up on, only the first gets a notice and it's sent before the second
+	result := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		outbox.Queue(&outMessage{
+			Channel: "1",
+			Send:    &discordgo.MessageSend{Content: "lost"},
+			Done:    func(m *discordgo.Message, err error) { result <- err },
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-result:
+			if err == nil {
+				t.Error("Expected the message to be given up on")
+			}
+		case <-time.After(expectTimeout):
+			t.Fatal("Timed out waiting for the outbox")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 1 {
+		t.Errorf("Expected one notice before the second message was given up on, got %d", len(received))
+	}
+}
+
+func TestOutboxPrivate(t *testing.T) {
+	var lock sync.Mutex
+	received := make([]string, 0)
+	created := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			created++
+			w.Write([]byte(`{"id": "dm", "type": 1, "recipients": [{"id": "alice"}]}`))
+			return
+		}
+
+		var msg discordgo.MessageSend
+		json.NewDecoder(r.Body).Decode(&msg)
+		received = append(received, r.URL.Path+" "+msg.Content)
+		w.Write([]byte(`{"id": "1", "channel_id": "dm"}`))
+	}))
+	defer server.Close()
+
+	channels, users := discordgo.EndpointChannels, discordgo.EndpointUsers
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	discordgo.EndpointUsers = server.URL + "/users/"
+	defer func() { discordgo.EndpointChannels, discordgo.EndpointUsers = channels, users }()
+
+	session, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(session)
+
+	result := make(chan error, 1)
+	outbox.Queue(&outMessage{
+		UserID: "alice",
+		Send:   &discordgo.MessageSend{Content: "your cards"},
+		Done:   func(m *discordgo.Message, err error) { result <- err },
+	})
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(expectTimeout):
+		t.Fatal("Timed out waiting for the outbox")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if created != 1 || len(received) != 1 || received[0] != "/channels/dm/messages your cards" {
+		t.Errorf("Expected the private channel to be created and sent to, got %d created and %q", created, received)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jonas747/joker/table"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Where tables are saved on shutdown
+var TablesFile = "tables.json"
+
+// A saved table, tables are saved on shutdown and restored in a stopped state on startup
+type TableSnapshot struct {
+	Channel       string
+	Owner         string
+	OwnerName     string
+	Config        table.Config
+	TimeOut       int
+	BannedPlayers []string
+	Hands         int
+	Bank          string `json:",omitempty"`
+	Players       []*SeatSnapshot
+	Tournament    *Tournament    `json:",omitempty"`
+	Blinds        *BlindSchedule `json:",omitempty"`
+	Fair          bool           `json:",omitempty"`
+	Cards         CardPrefs
+	View          bool `json:",omitempty"`
+}
+
+type SeatSnapshot struct {
+	Seat  int
+	ID    string
+	Name  string
+	Chips int
+}
+
+// Returns the money at the saved table, for tournaments that's the prize pool
+func (s *TableSnapshot) Chips() int {
+	if s.Tournament != nil {
+		return s.Tournament.Pool
+	}
+
+	chips := 0
+	for _, p := range s.Players {
+		chips += p.Chips
+	}
+	return chips
+}
+
+// Gives the players at the saved table their money back, for when it can't be saved or restored.
+// Tournament chips aren't worth anything so the prize pool is split by chip count instead, with the chip leader
+// getting what's left after rounding
+func (s *TableSnapshot) CashOut() {
+	src := MoneySource{Reason: ReasonCashOut, Channel: s.Channel, Hand: s.Hands, Bank: s.Bank}
+	if s.Tournament == nil {
+		for _, p := range s.Players {
+			if p.Chips > 0 {
+				GiveMoney(p.ID, p.Name, p.Chips, src)
+			}
+		}
+		return
+	}
+
+	src.Reason = ReasonRefund
+	if s.Tournament.Started {
+		src.Reason = ReasonPrize
+	}
+
+	total := 0
+	var leader *SeatSnapshot
+	for _, p := range s.Players {
+		total += p.Chips
+		if leader == nil || p.Chips > leader.Chips {
+			leader = p
+		}
+	}
+	if total < 1 {
+		log.Printf("Nobody to give the $%d prize pool of the table in %s to", s.Tournament.Pool, s.Channel)
+		return
+	}
+
+	pool := s.Tournament.Pool
+	shares := make(map[*SeatSnapshot]int)
+	for _, p := range s.Players {
+		shares[p] = pool * p.Chips / total
+		s.Tournament.Pool -= shares[p]
+	}
+	shares[leader] += s.Tournament.Pool
+	s.Tournament.Pool = 0
+
+	for _, p := range s.Players {
+		if shares[p] > 0 {
+			GiveMoney(p.ID, p.Name, shares[p], src)
+		}
+	}
+}
+
+// Gives the prize pool back to the entrants in equal parts, for a tournament table that couldn't be restored
+func (s *TableSnapshot) RefundTournament() {
+	if len(s.Players) < 1 {
+		log.Printf("Nobody to refund the $%d prize pool of the table in %s to", s.Tournament.Pool, s.Channel)
+		return
+	}
+
+	src := MoneySource{Reason: ReasonRefund, Channel: s.Channel, Hand: s.Hands, Bank: s.Bank}
+	share := s.Tournament.Pool / len(s.Players)
+	for k, p := range s.Players {
+		refund := share
+		if k == 0 {
+			refund += s.Tournament.Pool % len(s.Players) // What's left after splitting
+		}
+		if refund > 0 {
+			GiveMoney(p.ID, p.Name, refund, src)
+		}
+	}
+	s.Tournament.Pool = 0
+}
+
+// Snapshot saves the table, should only be called between hands
+func (t *Table) Snapshot() *TableSnapshot {
+	snapshot := &TableSnapshot{
+		Channel:       t.Channel,
+		Owner:         t.Owner,
+		OwnerName:     t.OwnerName,
+		Config:        t.Table.Config(),
+		TimeOut:       t.TimeOut,
+		BannedPlayers: t.BannedPlayers,
+		Hands:         t.Hands,
+		Bank:          t.Bank,
+		Players:       make([]*SeatSnapshot, 0),
+		Tournament:    t.Tournament,
+		Blinds:        t.Blinds,
+		Fair:          t.IsFair(),
+		Cards:         t.Cards,
+		View:          t.View,
+	}
+
+	for seat, p := range t.Table.Players() {
+		tablePlayer := asTablePlayer(p.Player())
+		snapshot.Players = append(snapshot.Players, &SeatSnapshot{
+			Seat:  seat,
+			ID:    tablePlayer.Id,
+			Name:  tablePlayer.Name,
+			Chips: p.Chips(),
+		})
+	}
+
+	return snapshot
+}
+
+// Recreates a table from a snapshot, the table is not started
+func (t *TableManager) RestoreTable(snapshot *TableSnapshot) *Table {
+	tbl := t.NewTable(snapshot.Channel, snapshot.Owner, snapshot.OwnerName, snapshot.Config)
+	tbl.TimeOut = snapshot.TimeOut
+	tbl.BannedPlayers = snapshot.BannedPlayers
+	tbl.Hands = snapshot.Hands
+	tbl.Bank = snapshot.Bank
+	tbl.Tournament = snapshot.Tournament
+	tbl.Blinds = snapshot.Blinds
+	tbl.SetFair(snapshot.Fair)
+	tbl.Cards = snapshot.Cards
+	tbl.View = snapshot.View
+
+	for _, p := range snapshot.Players {
+		tp := &TablePlayer{
+			Id:    p.ID,
+			Name:  p.Name,
+			Table: tbl,
+		}
+
+		err := tbl.Sit(tp, p.Seat, p.Chips)
+		if err != nil {
+			log.Printf("Failed restoring %s at table %s: %s", p.Name, snapshot.Channel, err)
+			// Better give him his money back than lose it, tournament chips are worth nothing though
+			if tbl.Tournament == nil {
+				GiveMoney(p.ID, p.Name, p.Chips, tbl.MoneySource(ReasonCashOut))
+			}
+		}
+	}
+
+	tbl.CheckReplaceOwner()
+	return tbl
+}
+
+// Writes all the saved tables to disk
+func (t *TableManager) SaveSnapshots() error {
+	if len(t.snapshots) < 1 {
+		return nil
+	}
+
+	out, err := json.Marshal(t.snapshots)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := TablesFile + ".tmp"
+	err = ioutil.WriteFile(tmpPath, out, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, TablesFile)
+}
+
+// Restores the tables saved on the last shutdown, the file is moved away afterwards so they're not restored twice
+func (t *TableManager) RestoreTables() error {
+	file, err := ioutil.ReadFile(TablesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var snapshots []*TableSnapshot
+	err = json.Unmarshal(file, &snapshots)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(TablesFile, TablesFile+".restored")
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		if t.GetTable(snapshot.Channel) != nil {
+			log.Printf("There's already a table in %s, cashing out the saved one", snapshot.Channel)
+			snapshot.CashOut()
+			continue
+		}
+
+		tbl := t.RestoreTable(snapshot)
+		if len(tbl.Table.Players()) < 1 {
+			if snapshot.Tournament != nil {
+				snapshot.RefundTournament()
+			}
+			continue
+		}
+
+		t.tables = append(t.tables, tbl)
+		t.Send(snapshot.Channel, "The bot restarted, your table is still here. Type `start` to continue playing")
+	}
+
+	log.Printf("Restored %d tables", len(t.tables))
+	return nil
+}
@@ -1,90 +1,192 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"log"
-	"os"
 	"sync"
-	"time"
 )
 
+const StartingMoney = 100
+
 type Player struct {
 	sync.Mutex
 	ID    string
 	Name  string
-	Money int
+	Money int // Balance in the global bank
+
+	Wallets map[string]int // Balances in guilds with an isolated economy, by guild id
+
+	Guilds []string // Guilds the player has played in
+	Hands  int
+	Profit int // Won minus lost in cash game hands
+	Prizes int // Money won in tournaments
+
+	CardStyle string // How they want to see their cards, empty to go with the table
+}
+
+// Returns the players balance in the bank, player should be locked
+func (p *Player) Balance(bank string) int {
+	if bank == GlobalBank {
+		return p.Money
+	}
+	return p.Wallets[bank]
+}
+
+func (p *Player) addMoney(bank string, delta int) {
+	if bank == GlobalBank {
+		p.Money += delta
+		return
+	}
+
+	if p.Wallets == nil {
+		p.Wallets = make(map[string]int)
+	}
+	p.Wallets[bank] += delta
+}
+
+// Returns the players money in all banks, player should be locked
+func (p *Player) TotalMoney() int {
+	total := p.Money
+	for _, v := range p.Wallets {
+		total += v
+	}
+	return total
+}
+
+// Returns true if the player has played in the guild, player should be locked
+func (p *Player) InGuild(guild string) bool {
+	for _, v := range p.Guilds {
+		if v == guild {
+			return true
+		}
+	}
+	return false
 }
 
 type PlayerManager struct {
 	sync.RWMutex
 	Players []*Player
+	Store   PlayerStore
+	Ledger  *Ledger
 	Stop    chan *sync.WaitGroup
+
+	byID map[string]*Player
+
+	// Sorted leaderboards, players that changed since they were last looked at are moved to their new places then
+	indexLock   sync.Mutex
+	indexes     map[string]*leaderboardIndex
+	changedLock sync.Mutex
+	changed     map[*Player]bool
+	guildLock   sync.Mutex
+	byGuild     map[string][]*Player // Players that played in the guild, for the server leaderboards
 }
 
+// Waits for the stop signal and closes the store and ledger, Load has to be called before anything uses the players
 func (pm *PlayerManager) Run() {
-	err := pm.Load()
+	wg := <-pm.Stop
+	err := pm.Store.Close()
 	if err != nil {
-		log.Println("Failed loading data, consider using backup")
-	}
-
-	ticker := time.NewTicker(time.Minute)
-	for {
-		select {
-		case <-ticker.C:
-			err := pm.Save()
-			if err != nil {
-				log.Printf("Error saving log: ", err)
-			}
-		case wg := <-pm.Stop:
-			pm.Save()
-			wg.Done()
-			return
-		}
+		log.Println("Failed closing player store:", err)
 	}
+	err = pm.Ledger.Close()
+	if err != nil {
+		log.Println("Failed closing ledger:", err)
+	}
+	wg.Done()
 }
 
 func (pm *PlayerManager) Load() error {
-	file, err := ioutil.ReadFile("players.json")
-	if err != nil {
-		return err
-	}
-	var decoded []*Player
-	err = json.Unmarshal(file, &decoded)
+	players, err := pm.Store.Load()
 	if err != nil {
 		return err
 	}
 
 	pm.Lock()
-	pm.Players = decoded
+	pm.Players = players
+	pm.byID = make(map[string]*Player)
+	for _, p := range players {
+		pm.byID[p.ID] = p
+	}
 	pm.Unlock()
+	pm.resetIndexes(players)
+
+	// First time running with a ledger, record what everyone has so it can be replayed
+	if pm.Ledger.Empty() {
+		return pm.Ledger.RecordOpening(players)
+	}
 	return nil
 }
 
-func (pm *PlayerManager) Save() error {
-	// Rotate savedata if existing
-	_, err := os.Stat("players.json")
-	if err == nil {
-
-		err := os.Rename("players.json", "players.json.1")
-		if err != nil {
-			return err
-		}
+// Returns the card style the player picked, empty if they didn't or never played
+func (pm *PlayerManager) CardStyle(id string) string {
+	pm.RLock()
+	player, ok := pm.byID[id]
+	pm.RUnlock()
+	if !ok {
+		return ""
 	}
 
-	pm.Lock()
-	out, err := json.Marshal(pm.Players)
-	pm.Unlock()
+	player.Lock()
+	defer player.Unlock()
+	return player.CardStyle
+}
+
+// Records the change in the ledger and commits the player to the store, player should be locked
+func (pm *PlayerManager) Commit(player *Player, delta int, src MoneySource) {
+	err := pm.Ledger.Record(player.ID, delta, src)
 	if err != nil {
-		return err
+		log.Printf("Failed recording ledger entry for %s (%s): %s", player.Name, player.ID, err)
 	}
 
-	file, err := os.Create("players.json")
+	if src.Reason == ReasonPrize {
+		player.Prizes += delta
+	}
+	pm.Save(player)
+}
+
+// Commits the player to the store, player should be locked
+func (pm *PlayerManager) Save(player *Player) {
+	err := pm.Store.Save(player)
 	if err != nil {
-		return err
+		log.Printf("Failed saving player %s (%s): %s", player.Name, player.ID, err)
+	}
+	pm.MarkChanged(player)
+}
+
+// Updates the hands and profit of everyone in the hand and remembers the guild it was played in
+func (pm *PlayerManager) RecordHand(h *HandHistory, guild string) {
+	for _, hp := range h.Players {
+		if IsBot(hp.ID) {
+			continue
+		}
+
+		player := pm.GetCreatePlayer(hp.ID, hp.Name)
+
+		player.Lock()
+		player.Hands++
+		if !h.Tournament {
+			player.Profit += h.Net(hp.Seat)
+		}
+		if guild != "" && !player.InGuild(guild) {
+			player.Guilds = append(player.Guilds, guild)
+			pm.addToGuild(player, guild)
+		}
+		pm.Save(player)
+		player.Unlock()
 	}
-	file.Write(out)
-	return file.Close()
+}
+
+// Returns the sum of all players money
+func (pm *PlayerManager) TotalMoney() int {
+	pm.RLock()
+	defer pm.RUnlock()
+
+	total := 0
+	for _, p := range pm.Players {
+		p.Lock()
+		total += p.TotalMoney()
+		p.Unlock()
+	}
+	return total
 }
 
 func (pm *PlayerManager) AddPlayer(player *Player, lock bool) {
@@ -94,30 +196,73 @@ func (pm *PlayerManager) AddPlayer(player *Player, lock bool) {
 	}
 
 	pm.Players = append(pm.Players, player)
+	if pm.byID == nil {
+		pm.byID = make(map[string]*Player)
+	}
+	pm.byID[player.ID] = player
 }
 
 func (pm *PlayerManager) GetCreatePlayer(id, name string) *Player {
+	pm.RLock()
+	player, ok := pm.byID[id]
+	pm.RUnlock()
+	if ok {
+		return player
+	}
+
 	pm.Lock()
 	defer pm.Unlock()
 
-	for _, v := range pm.Players {
-		if v.ID == id {
-			return v
-		}
+	// Someone might have created him while we weren't holding the lock
+	if player, ok := pm.byID[id]; ok {
+		return player
 	}
 
-	player := &Player{
+	player = &Player{
 		Name:  name,
 		ID:    id,
-		Money: 100,
+		Money: StartingMoney,
 	}
 	pm.AddPlayer(player, false)
+	pm.Commit(player, player.Money, MoneySource{Reason: ReasonNewPlayer})
 	return player
 }
 
-func GiveMoney(id, name string, money int) {
+// Opens a wallet with the starting money the first time the player uses an isolated bank, player should be locked
+func (pm *PlayerManager) EnsureWallet(player *Player, bank string) {
+	if bank == GlobalBank {
+		return
+	}
+	if _, ok := player.Wallets[bank]; ok {
+		return
+	}
+
+	player.addMoney(bank, StartingMoney)
+	pm.Commit(player, StartingMoney, MoneySource{Reason: ReasonNewPlayer, Bank: bank})
+}
+
+// Gives money to the player in the bank of the source
+func GiveMoney(id, name string, money int, src MoneySource) {
 	player := playerManager.GetCreatePlayer(id, name)
 	player.Lock()
-	player.Money += money
+	playerManager.EnsureWallet(player, src.Bank)
+	player.addMoney(src.Bank, money)
+	playerManager.Commit(player, money, src)
 	player.Unlock()
 }
+
+// Takes money from the player in the bank of the source if he has enough, returns false if not
+func TakeMoney(id, name string, money int, src MoneySource) bool {
+	player := playerManager.GetCreatePlayer(id, name)
+	player.Lock()
+	defer player.Unlock()
+
+	playerManager.EnsureWallet(player, src.Bank)
+	if player.Balance(src.Bank) < money {
+		return false
+	}
+
+	player.addMoney(src.Bank, -money)
+	playerManager.Commit(player, -money, src)
+	return true
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Card styles
+const (
+	StyleImage = "image"
+	StyleASCII = "ascii"
+	StyleEmoji = "emoji"
+)
+
+const (
+	cardWidth  = 64
+	cardHeight = 92
+	cardGap    = 8
+	cardMargin = 12
+	cardRadius = 6
+
+	glyphSize  = 9 // Glyphs are cells this big in the glyph sheet
+	glyphRanks = "A23456789TJQK"
+	glyphSuits = "shdc" // Come right after the ranks
+)
+
+//go:embed assets/cards
+var cardAssets embed.FS // Glyph sheet, card backs and felts, built in so nothing is fetched when rendering
+
+// How cards are shown, empty fields are the defaults
+type CardPrefs struct {
+	Style     string `json:",omitempty"` // image, ascii or emoji
+	FourColor bool   `json:",omitempty"` // Diamonds blue and clubs green instead of both red and black
+	Back      string `json:",omitempty"` // Card back theme, drawn where board cards are still to come
+	Felt      string `json:",omitempty"` // Background theme
+}
+
+func (c CardPrefs) GetStyle() string {
+	if c.Style == "" {
+		return StyleImage
+	}
+	return c.Style
+}
+
+func (c CardPrefs) GetBack() string {
+	if c.Back == "" {
+		return "red"
+	}
+	return c.Back
+}
+
+func (c CardPrefs) GetFelt() string {
+	if c.Felt == "" {
+		return "green"
+	}
+	return c.Felt
+}
+
+func (c CardPrefs) String() string {
+	out := "**" + c.GetStyle() + "**"
+	if c.GetStyle() != StyleImage {
+		return out
+	}
+	if c.FourColor {
+		out += ", four color"
+	}
+	return out + fmt.Sprintf(", %s back, %s felt", c.GetBack(), c.GetFelt())
+}
+
+// Checks the style is known, returns it lowercased
+func ParseCardStyle(style string) (string, error) {
+	style = strings.ToLower(strings.TrimSpace(style))
+	switch style {
+	case StyleImage, StyleASCII, StyleEmoji:
+		return style, nil
+	}
+	return "", errors.New("Card style has to be image, ascii or emoji")
+}
+
+var (
+	glyphsOnce sync.Once
+	glyphs     image.Image
+	glyphsErr  error
+
+	themesLock sync.Mutex
+	themes     = make(map[string]image.Image) // Decoded backs and felts by path
+)
+
+// Returns the names of the themes in the dir, like the backs or felts
+func CardThemes(dir string) []string {
+	entries, err := cardAssets.ReadDir("assets/cards/" + dir)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".png"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checks the theme exists in the dir, returns it lowercased
+func ParseCardTheme(dir, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, v := range CardThemes(dir) {
+		if v == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown %s, there's %s", strings.TrimSuffix(dir, "s"), strings.Join(CardThemes(dir), ", "))
+}
+
+func decodeAsset(path string) (image.Image, error) {
+	f, err := cardAssets.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func loadTheme(dir, name string) (image.Image, error) {
+	path := "assets/cards/" + dir + "/" + name + ".png"
+
+	themesLock.Lock()
+	defer themesLock.Unlock()
+	if img, ok := themes[path]; ok {
+		return img, nil
+	}
+
+	img, err := decodeAsset(path)
+	if err != nil {
+		return nil, err
+	}
+	themes[path] = img
+	return img, nil
+}
+
+// Suit colours, the four colour deck makes diamonds and clubs easy to tell from hearts and spades
+func suitColor(suit byte, fourColor bool) color.Color {
+	switch suit {
+	case 'h':
+		return color.RGBA{0xcc, 0x10, 0x10, 0xff}
+	case 'd':
+		if fourColor {
+			return color.RGBA{0x10, 0x40, 0xd0, 0xff}
+		}
+		return color.RGBA{0xcc, 0x10, 0x10, 0xff}
+	case 'c':
+		if fourColor {
+			return color.RGBA{0x10, 0x8a, 0x20, 0xff}
+		}
+	}
+	return color.RGBA{0x10, 0x10, 0x10, 0xff}
+}
+
+// Draws the glyph scaled up at x, y in the colour, the sheet is white so only its alpha is used
+func drawGlyph(dst draw.Image, index, x, y, scale int, col color.Color) {
+	cell := image.Rect(index*glyphSize, 0, (index+1)*glyphSize, glyphSize)
+	src := &image.Uniform{col}
+	for gy := cell.Min.Y; gy < cell.Max.Y; gy++ {
+		for gx := cell.Min.X; gx < cell.Max.X; gx++ {
+			if _, _, _, a := glyphs.At(gx, gy).RGBA(); a == 0 {
+				continue
+			}
+			px := x + (gx-cell.Min.X)*scale
+			py := y + (gy-cell.Min.Y)*scale
+			draw.Draw(dst, image.Rect(px, py, px+scale, py+scale), src, image.Point{}, draw.Over)
+		}
+	}
+}
+
+// Returns true if the point is inside the card with rounded corners
+func insideCard(x, y int) bool {
+	cx, cy := x, y
+	if x < cardRadius {
+		cx = cardRadius
+	} else if x >= cardWidth-cardRadius {
+		cx = cardWidth - cardRadius - 1
+	}
+	if y < cardRadius {
+		cy = cardRadius
+	} else if y >= cardHeight-cardRadius {
+		cy = cardHeight - cardRadius - 1
+	}
+	dx, dy := x-cx, y-cy
+	return dx*dx+dy*dy <= cardRadius*cardRadius
+}
+
+// Fills the card shape at x, y, with the border colour on the edge and fill inside
+func drawCardShape(dst draw.Image, x, y int, border color.Color, fill func(cx, cy int) color.Color) {
+	for cy := 0; cy < cardHeight; cy++ {
+		for cx := 0; cx < cardWidth; cx++ {
+			if !insideCard(cx, cy) {
+				continue
+			}
+			edge := !insideCard(cx-1, cy) || !insideCard(cx+1, cy) || !insideCard(cx, cy-1) || !insideCard(cx, cy+1)
+			if edge {
+				dst.Set(x+cx, y+cy, border)
+			} else {
+				dst.Set(x+cx, y+cy, fill(cx, cy))
+			}
+		}
+	}
+}
+
+func drawCard(dst draw.Image, x, y int, card *hand.Card, fourColor bool) {
+	white := color.RGBA{0xfa, 0xfa, 0xfa, 0xff}
+	drawCardShape(dst, x, y, color.RGBA{0x80, 0x80, 0x80, 0xff}, func(cx, cy int) color.Color { return white })
+
+	ps := psCard(card)
+	rank := strings.IndexByte(glyphRanks, ps[0])
+	suit := strings.IndexByte(glyphSuits, ps[1])
+	if rank < 0 || suit < 0 {
+		return
+	}
+
+	col := suitColor(ps[1], fourColor)
+	suitGlyph := len(glyphRanks) + suit
+	drawGlyph(dst, rank, x+4, y+4, 2, col)
+	drawGlyph(dst, suitGlyph, x+4, y+24, 2, col)
+	drawGlyph(dst, suitGlyph, x+(cardWidth-glyphSize*4)/2+6, y+cardHeight-glyphSize*4-8, 4, col)
+}
+
+func drawCardBack(dst draw.Image, x, y int, back image.Image) {
+	size := back.Bounds().Size()
+	white := color.RGBA{0xfa, 0xfa, 0xfa, 0xff}
+	drawCardShape(dst, x, y, color.RGBA{0x80, 0x80, 0x80, 0xff}, func(cx, cy int) color.Color {
+		// A white frame around the pattern
+		if cx < 5 || cy < 5 || cx >= cardWidth-5 || cy >= cardHeight-5 {
+			return white
+		}
+		return back.At(back.Bounds().Min.X+cx%size.X, back.Bounds().Min.Y+cy%size.Y)
+	})
+}
+
+// RenderCards draws the cards side by side on the felt as a PNG. Slots is how many places to draw, the ones after
+// the cards get a card back, like the turn and river before they're dealt
+func RenderCards(cards []*hand.Card, slots int, prefs CardPrefs) ([]byte, error) {
+	glyphsOnce.Do(func() {
+		glyphs, glyphsErr = decodeAsset("assets/cards/glyphs.png")
+	})
+	if glyphsErr != nil {
+		return nil, glyphsErr
+	}
+
+	back, err := loadTheme("backs", prefs.GetBack())
+	if err != nil {
+		return nil, err
+	}
+	felt, err := loadTheme("felts", prefs.GetFelt())
+	if err != nil {
+		return nil, err
+	}
+
+	if slots < len(cards) {
+		slots = len(cards)
+	}
+	if slots < 1 {
+		return nil, errors.New("No cards to draw")
+	}
+
+	width := cardMargin*2 + slots*cardWidth + (slots-1)*cardGap
+	height := cardMargin*2 + cardHeight
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	feltSize := felt.Bounds().Size()
+	for y := 0; y < height; y += feltSize.Y {
+		for x := 0; x < width; x += feltSize.X {
+			draw.Draw(img, image.Rect(x, y, x+feltSize.X, y+feltSize.Y), felt, felt.Bounds().Min, draw.Src)
+		}
+	}
+
+	for i := 0; i < slots; i++ {
+		x := cardMargin + i*(cardWidth+cardGap)
+		if i < len(cards) {
+			drawCard(img, x, cardMargin, cards[i], prefs.FourColor)
+		} else {
+			drawCardBack(img, x, cardMargin, back)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+var emojiSuits = map[hand.Suit]string{
+	hand.Spades:   "♠️",
+	hand.Hearts:   "♥️",
+	hand.Diamonds: "♦️",
+	hand.Clubs:    "♣️",
+}
+
+// Returns the cards as short text with suit emojis, like A♠️ 10♥️
+func emojiCards(cards []*hand.Card) string {
+	out := make([]string, len(cards))
+	for k, c := range cards {
+		rank := string(c.Rank())
+		if rank == "T" {
+			rank = "10"
+		}
+		out[k] = "**" + rank + "**" + emojiSuits[c.Suit()]
+	}
+	return strings.Join(out, " ")
+}
+
+// Sends the cards the way prefs says, privately if userID is set or to the channel otherwise. Text is the cards
+// written out, sent along with images and the ascii cards
+func SendCards(transport Transport, channel, userID, title, text string, cards []*hand.Card, slots int, prefs CardPrefs) {
+	send := func(msg string) {
+		if userID != "" {
+			transport.SendPrivateMessage(userID, msg)
+		} else {
+			transport.SendMessage(channel, msg)
+		}
+	}
+
+	switch prefs.GetStyle() {
+	case StyleEmoji:
+		send(title + "\n" + emojiCards(cards))
+		return
+	case StyleImage:
+		data, err := RenderCards(cards, slots, prefs)
+		if err != nil {
+			log.Println("Failed rendering cards:", err)
+			break
+		}
+
+		name := strings.ToLower(strings.Replace(title, " ", "-", -1)) + ".png"
+		if userID != "" {
+			transport.SendPrivateFile(userID, title+"\n"+text, name, data)
+		} else {
+			transport.SendFile(channel, title+"\n"+text, name, data)
+		}
+		return
+	}
+
+	send(fmt.Sprintf("%s\n```\n%s\n```\n%s", title, createAsciiCards(cards, " "), text))
+}
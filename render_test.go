@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestRenderCards(t *testing.T) {
+	cards, err := ParseCards("AsTh9d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A flop with the turn and river still face down
+	for _, prefs := range []CardPrefs{{}, {FourColor: true, Back: "blue", Felt: "red"}} {
+		data, err := RenderCards(cards, 5, prefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := img.Bounds().Size()
+		if size.X != cardMargin*2+5*cardWidth+4*cardGap || size.Y != cardMargin*2+cardHeight {
+			t.Errorf("Expected room for 5 cards, got %v", size)
+		}
+	}
+
+	if _, err := RenderCards(cards, 3, CardPrefs{Back: "plaid"}); err == nil {
+		t.Error("Expected an unknown back to fail")
+	}
+	if _, err := ParseCardTheme("felts", "Green"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/table"
+	"sort"
+	"strings"
+)
+
+// What came out of replaying a recorded hand
+type ReplayResult struct {
+	Hand        *HandHistory
+	Won         map[int]int // Chips won in the replay, by the seat the player had in the recorded hand
+	Differences []string    // Empty if the replay paid out the same as the recorded hand
+}
+
+func (r *ReplayResult) Matches() bool {
+	return len(r.Differences) < 1
+}
+
+func (r *ReplayResult) String() string {
+	out := fmt.Sprintf("Replayed hand #%d from <#%s>", r.Hand.ID, r.Hand.Channel)
+	if r.Hand.Seed != 0 {
+		out += fmt.Sprintf(", deck seed %d", r.Hand.Seed)
+	}
+	out += "\n"
+
+	for _, p := range r.Hand.Players {
+		out += fmt.Sprintf(" - %s (seat %d): won %d\n", p.Name, p.Seat+1, r.Won[p.Seat])
+	}
+
+	if r.Matches() {
+		return out + "Everything matches what was paid"
+	}
+	return out + "**Differences:**\n - " + strings.Join(r.Differences, "\n - ")
+}
+
+// Plays the recorded actions, the table asks the player to act and gets the next one
+type replayPlayer struct {
+	id     string
+	replay *handReplay
+}
+
+func (p *replayPlayer) ID() string {
+	return p.id
+}
+
+func (p *replayPlayer) FromID(id string) (table.Player, error) {
+	return &replayPlayer{id: id}, nil
+}
+
+func (p *replayPlayer) Action() (table.Action, int) {
+	if p.replay == nil {
+		return table.Fold, 0
+	}
+	return p.replay.next(p.id)
+}
+
+type handReplay struct {
+	hand        *HandHistory
+	seats       map[string]int // Seat in the recorded hand by player id
+	actions     []*HistoryAction
+	differences []string
+}
+
+func (r *handReplay) next(id string) (table.Action, int) {
+	seat := r.seats[id]
+	name := r.hand.Player(seat).Name
+
+	if len(r.actions) < 1 {
+		r.differences = append(r.differences, name+" had to act after the last recorded action")
+		return table.Fold, 0
+	}
+
+	action := r.actions[0]
+	r.actions = r.actions[1:]
+	if action.Seat != seat {
+		r.differences = append(r.differences, fmt.Sprintf("%s had to act but %s did in the recorded hand", name, r.hand.Player(action.Seat).Name))
+	}
+	return table.Action(action.Action), action.Chips
+}
+
+// Sits the players at a new table, players are moved to the seats in the seats map
+func newReplayTable(h *HandHistory, dealer *StackedDealer, seats map[int]int, replay *handReplay) (*table.Table, error) {
+	tbl := table.New(table.Config{
+		Game:       h.Game,
+		Limit:      h.Limit,
+		Stakes:     h.Stakes,
+		NumOfSeats: h.Seats,
+	}, dealer)
+
+	for _, p := range h.Players {
+		err := tbl.Sit(&replayPlayer{id: p.ID, replay: replay}, seats[p.Seat], p.Chips)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tbl, nil
+}
+
+// ReplayHand deals the hand again from the recorded deck, plays the recorded actions
+// and checks everyone won what they were paid
+func ReplayHand(h *HandHistory) (*ReplayResult, error) {
+	if len(h.Deck) < 1 {
+		return nil, errors.New("This hand was played before decks were recorded, it can't be replayed")
+	}
+
+	deck, err := ParseCards(strings.Join(h.Deck, " "))
+	if err != nil {
+		return nil, err
+	}
+	dealer := &StackedDealer{Cards: deck}
+
+	occupied := make([]int, 0, len(h.Players))
+	seats := make(map[int]int)
+	for _, p := range h.Players {
+		occupied = append(occupied, p.Seat)
+		seats[p.Seat] = p.Seat
+	}
+	sort.Ints(occupied)
+
+	// A new table puts the button wherever it likes, so see where it goes and then move everyone around it
+	// so the same player has the button with everyone in the same order
+	dry, err := newReplayTable(h, dealer, seats, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = dry.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	newButton, oldButton := -1, -1
+	for k, seat := range occupied {
+		if seat == dry.Button() {
+			newButton = k
+		}
+		if seat == h.Button {
+			oldButton = k
+		}
+	}
+	if newButton == -1 || oldButton == -1 {
+		return nil, errors.New("Couldn't find the button")
+	}
+
+	original := make(map[int]int) // Recorded seat by the seat in the replay
+	for k, seat := range occupied {
+		from := occupied[(k+oldButton-newButton+len(occupied))%len(occupied)]
+		seats[from] = seat
+		original[seat] = from
+	}
+
+	replay := &handReplay{hand: h, seats: make(map[string]int)}
+	for _, p := range h.Players {
+		replay.seats[p.ID] = p.Seat
+	}
+	for _, a := range h.Actions {
+		switch a.Action {
+		case postAnte, postSmallBlind, postBigBlind, postBringIn:
+		default:
+			replay.actions = append(replay.actions, a)
+		}
+	}
+
+	tbl, err := newReplayTable(h, dealer, seats, replay)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{Hand: h, Won: make(map[int]int)}
+	for i := 0; ; i++ {
+		// Every step either deals or someone acts, so something went very wrong if it's still going
+		if i > 1000 {
+			return nil, errors.New("The replayed hand never finished")
+		}
+
+		results, done, err := tbl.Next()
+		if err != nil {
+			replay.differences = append(replay.differences, "The table refused an action: "+err.Error())
+			break
+		}
+
+		if results != nil {
+			for seat, resultList := range results {
+				for _, r := range resultList {
+					result.Won[original[seat]] += r.Chips
+				}
+			}
+			break
+		}
+
+		if done {
+			replay.differences = append(replay.differences, "The replayed hand ended without results")
+			break
+		}
+	}
+
+	if len(replay.actions) > 0 {
+		replay.differences = append(replay.differences, fmt.Sprintf("%d recorded actions were never made", len(replay.actions)))
+	}
+
+	paid := make(map[int]int)
+	for _, r := range h.Results {
+		paid[r.Seat] += r.Chips
+	}
+	for _, p := range h.Players {
+		if paid[p.Seat] != result.Won[p.Seat] {
+			replay.differences = append(replay.differences, fmt.Sprintf("%s was paid %d but won %d in the replay", p.Name, paid[p.Seat], result.Won[p.Seat]))
+		}
+	}
+
+	result.Differences = replay.differences
+	return result, nil
+}
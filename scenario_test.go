@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testDeck = "Ah Kh 7c 2d Qh Jh Th 3s 4c 9d"
+
+func otherPlayer(user string) string {
+	if user == "alice" {
+		return "bob"
+	}
+	return "alice"
+}
+
+func TestScriptedHand(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100")
+	h.Expect("poker", "Created table")
+	h.Expect("poker", "bob Joined the table")
+	h.AssertBalance("alice", 0)
+	h.AssertBalance("bob", 0)
+
+	h.Script("poker", "alice: start / alice: stop")
+	h.Expect("poker", "Started table")
+
+	first := h.Turn("poker")
+	h.Say("poker", first, "raise 10")
+	second := h.Turn("poker")
+	if second != otherPlayer(first) {
+		t.Fatalf("Expected %s to act after %s, got %s", otherPlayer(first), first, second)
+	}
+	h.Say("poker", second, "call")
+
+	results := h.CheckDown("poker")
+	if !strings.Contains(results, "Someone stopped the table") {
+		t.Errorf("Expected the table to stop after the hand, got %q", results)
+	}
+	h.Expect("poker", "Stopped table")
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+	h.Stop()
+
+	alice, bob := h.Balance("alice"), h.Balance("bob")
+	if alice+bob != 200 {
+		t.Errorf("Money went missing, alice has $%d and bob $%d", alice, bob)
+	}
+
+	hands, err := tableManager.HandLog.Recent("alice", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hands) != 1 {
+		t.Errorf("Expected 1 hand in the history, got %d", len(hands))
+	}
+}
+
+func TestLeaveAfterFold(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: start")
+
+	leaver := h.Turn("poker")
+	h.Say("poker", leaver, "leave")
+	h.Expect("poker", "Leaving after round")
+	h.Say("poker", leaver, "fold")
+	h.Expect("poker", leaver+" stood up")
+	h.Expect("poker", "Stopped table")
+
+	stayer := otherPlayer(leaver)
+	h.Say("poker", stayer, "leave")
+	h.Expect("poker", "**"+stayer+"** stoop up")
+	h.Stop()
+
+	if h.Balance(leaver) >= 100 {
+		t.Errorf("Expected %s to lose the blind, has $%d", leaver, h.Balance(leaver))
+	}
+	if h.Balance(leaver)+h.Balance(stayer) != 200 {
+		t.Errorf("Money went missing, %s has $%d and %s $%d", leaver, h.Balance(leaver), stayer, h.Balance(stayer))
+	}
+}
+
+func TestKick(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / alice: conf set timeout 1 / bob: join 100 / carol: join 100")
+	h.Expect("poker", "carol Joined the table")
+
+	// Only the owner can kick
+	h.Say("poker", "bob", "kick @carol")
+	h.Expect("poker", "Only owner of table can do this")
+
+	// Not playing, so carol stands up right away
+	h.Say("poker", "alice", "kick @carol")
+	h.Expect("poker", "**carol** stoop up")
+
+	// Playing, so bob is folded and stands up after the hand
+	h.Script("poker", "alice: start / alice: stop")
+	first := h.Turn("poker")
+	h.Say("poker", "alice", "kick @bob")
+	h.Expect("poker", "Leaving after round")
+	if first == "alice" {
+		h.Say("poker", "alice", "call")
+	}
+	h.Expect("poker", "bob stood up")
+	h.Expect("poker", "Stopped table")
+
+	h.Say("poker", "alice", "leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Stop()
+
+	h.AssertBalance("carol", 100)
+	if h.Balance("alice")+h.Balance("bob") != 200 {
+		t.Errorf("Money went missing, alice has $%d and bob $%d", h.Balance("alice"), h.Balance("bob"))
+	}
+}
+
+func TestTournamentStart(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: tournament create 10 4 / bob: tournament join")
+	h.Expect("poker", "bob registered (2/4)")
+
+	// Starting early would close registration, it waits for the seats to fill
+	h.Say("poker", "carol", "start")
+	h.Expect("poker", "Tournaments start by themselves")
+	h.Say("poker", "carol", "tournament join")
+	h.Expect("poker", "carol registered (3/4)")
+
+	h.Script("poker", "alice: leave / bob: leave / carol: leave")
+	h.Expect("poker", "**carol** unregistered from the tournament")
+	h.Stop()
+
+	for _, user := range []string{"alice", "bob", "carol"} {
+		h.AssertBalance(user, 100)
+	}
+}
+
+func TestBan(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: ban @bob")
+	h.Expect("poker", "**bob** stoop up")
+	h.Expect("poker", "**bob** is banned from this table")
+
+	h.Say("poker", "bob", "join 100")
+	h.Expect("poker", "You're banned from this table")
+	h.AssertBalance("bob", 100)
+
+	h.Say("poker", "alice", "leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Stop()
+
+	h.AssertBalance("alice", 100)
+	h.AssertBalance("bob", 100)
+}
+
+func TestTimeout(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / alice: conf set timeout 1 / bob: join 100 / alice: start / alice: stop")
+
+	// Nobody acts, the first player is folded when the time runs out
+	first := h.Turn("poker")
+	results := h.Expect("poker", "Results:")
+	if !strings.Contains(results, otherPlayer(first)) {
+		t.Errorf("Expected %s to win, got %q", otherPlayer(first), results)
+	}
+	h.Expect("poker", "Stopped table")
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+	h.Stop()
+
+	if h.Balance(first) >= 100 {
+		t.Errorf("Expected %s to lose the blind, has $%d", first, h.Balance(first))
+	}
+	if h.Balance("alice")+h.Balance("bob") != 200 {
+		t.Errorf("Money went missing, alice has $%d and bob $%d", h.Balance("alice"), h.Balance("bob"))
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: start")
+	first := h.Turn("poker")
+
+	// The hand is finished before the table is saved
+	wait := h.Shutdown()
+	h.Expect("poker", "Bot is shutting down after this hand")
+	h.Say("poker", first, "fold")
+	h.Expect("poker", "Bot is shutting down...")
+	wait()
+
+	// Everyones money is still at the table
+	h.AssertBalance("alice", 0)
+	h.AssertBalance("bob", 0)
+
+	file, err := ioutil.ReadFile(TablesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshots []*TableSnapshot
+	err = json.Unmarshal(file, &snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 1 {
+		t.Fatalf("Expected 1 saved table, got %d", len(snapshots))
+	}
+	if len(snapshots[0].Players) != 2 {
+		t.Errorf("Expected 2 players at the saved table, got %d", len(snapshots[0].Players))
+	}
+	if snapshots[0].Chips() != 200 {
+		t.Errorf("Expected 200 chips at the saved table, got %d", snapshots[0].Chips())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: start / alice: stop")
+	first := h.Turn("poker")
+	h.Say("poker", first, "raise 6")
+	h.CheckDown("poker")
+	h.Expect("poker", "Stopped table")
+
+	hand, err := tableManager.HandLog.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hand == nil {
+		t.Fatal("Hand 1 wasn't recorded")
+	}
+	if strings.Join(hand.Deck[:3], " ") != "Ah Kh 7c" {
+		t.Errorf("Expected the stacked deck to be recorded, got %v", hand.Deck)
+	}
+
+	result, err := ReplayHand(hand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Matches() {
+		t.Errorf("Expected the replay to match, got %s", result)
+	}
+
+	// A wrong payout should be noticed
+	hand.Results[0].Chips++
+	result, err = ReplayHand(hand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matches() {
+		t.Error("Expected the replay to notice the wrong payout")
+	}
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+}
+
+func TestProvablyFair(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / alice: conf set fair on / bob: join 100")
+	h.Expect("poker", "Provably fair: **on**")
+
+	h.Script("poker", "bob: entropy lucky river / carol: entropy rigged")
+	h.Expect("poker", "Mixed bob's entropy into the next hand")
+	h.Expect("poker", "Only players at the table can add entropy")
+
+	h.Script("poker", "alice: start / alice: stop")
+	commitment := h.Expect("poker", "The next hand is dealt from the seed with the sha256 hash")
+	turn := h.Turn("poker")
+
+	// The deck is dealt, it's too late for this hand and the next one's seed isn't public yet
+	h.Say("poker", "bob", "entropy too late")
+	h.Expect("poker", "Entropy can only be added after the hash of the next seed is posted")
+	h.Say("poker", turn, "fold")
+	h.Expect("poker", "Hand #1 was dealt from the seed")
+	h.Expect("poker", "Stopped table")
+
+	hand, err := tableManager.HandLog.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hand.Fair == nil || !strings.Contains(commitment, hand.Fair.Commitment) {
+		t.Fatalf("Expected the published commitment to be recorded, got %v", hand.Fair)
+	}
+	if len(hand.Fair.Entropy) != 1 || hand.Fair.Entropy[0] != "lucky river" {
+		t.Errorf("Expected bob's entropy to be recorded, got %v", hand.Fair.Entropy)
+	}
+
+	err = VerifyHand(hand)
+	if err != nil {
+		t.Errorf("Expected the hand to verify, got %s", err)
+	}
+
+	// Any other entropy gives another deck
+	hand.Fair.Entropy = []string{"lucky rivers"}
+	if VerifyHand(hand) == nil {
+		t.Error("Expected changed entropy to fail verification")
+	}
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+}
+
+func TestBots(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / alice: addbot random / bob: addbot")
+	h.Expect("poker", "(random) Joined the table")
+	h.Expect("poker", "Only owner of table can do this")
+
+	h.Script("poker", "alice: start / alice: stop")
+	h.CheckDown("poker")
+	h.Expect("poker", "Stopped table")
+
+	// The bot doesn't stay once everyone else is gone
+	h.Say("poker", "alice", "leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "(random) stood up")
+	h.Stop()
+
+	for _, p := range playerManager.Players {
+		if IsBot(p.ID) {
+			t.Errorf("Expected bots to never get a wallet, %s has one", p.ID)
+		}
+	}
+
+	// Whatever alice won or lost came from or went to the house
+	if total, faucets := playerManager.TotalMoney(), playerManager.Ledger.Faucets(); total != faucets {
+		t.Errorf("Expected the house money to balance out, players have $%d but $%d was created", total, faucets)
+	}
+}
+
+func TestControls(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: start / alice: stop")
+
+	// Amount asks for how much, the next thing the player says is the raise
+	first := h.Turn("poker")
+	h.Press("poker", first, "Amount")
+	h.Expect("poker", "how much? Type the amount")
+	h.Say("poker", first, "6")
+
+	// Pressing a control is the same as typing it
+	second := h.Turn("poker")
+	h.Press("poker", second, "Call")
+	h.CheckDown("poker")
+	h.Expect("poker", "Stopped table")
+
+	hand, err := tableManager.HandLog.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hand.Actions[2].Action != raise || hand.Actions[3].Action != call {
+		t.Errorf("Expected a raise and a call, got %s and %s", hand.Actions[2].Action, hand.Actions[3].Action)
+	}
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+}
+
+func TestShortActions(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: start / alice: stop")
+
+	// One letter only counts from the player whose turn it is
+	first := h.Turn("poker")
+	h.Say("poker", otherPlayer(first), "f")
+	h.Say("poker", first, "c")
+	second := h.Turn("poker")
+	if second != otherPlayer(first) {
+		t.Fatalf("Expected %s to act after %s, got %s", otherPlayer(first), first, second)
+	}
+	h.Say("poker", second, "x")
+	h.CheckDown("poker")
+	h.Expect("poker", "Stopped table")
+
+	hand, err := tableManager.HandLog.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hand.Actions[2].Action != call || hand.Actions[3].Action != check {
+		t.Errorf("Expected a call and a check, got %s and %s", hand.Actions[2].Action, hand.Actions[3].Action)
+	}
+
+	h.Script("poker", "alice: leave / bob: leave")
+	h.Expect("poker", "**alice** stoop up")
+	h.Expect("poker", "**bob** stoop up")
+}
+
+func TestSlashCommands(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	slash := func(user, name string, options map[string]interface{}) string {
+		si := &slashInvocation{
+			Name:    name,
+			User:    &discordgo.User{ID: user, Username: user},
+			Channel: "poker",
+			Options: make(map[string]*discordgo.ApplicationCommandInteractionDataOption),
+		}
+		for k, v := range options {
+			opt := &discordgo.ApplicationCommandInteractionDataOption{Name: k, Type: discordgo.ApplicationCommandOptionString, Value: v}
+			if _, ok := v.(float64); ok {
+				opt.Type = discordgo.ApplicationCommandOptionInteger
+			}
+			si.Options[k] = opt
+		}
+
+		reply, private := slashHandlers[name](si)
+		if !private {
+			t.Errorf("Expected the reply to /%s to be private", name)
+		}
+		return reply
+	}
+
+	slash("alice", "create", map[string]interface{}{"buyin": 100.0, "small": 1.0, "big": 2.0, "game": "omaha"})
+	h.Expect("poker", "Created table")
+	slash("alice", "config set", map[string]interface{}{"key": "fair", "value": "on"})
+	h.Expect("poker", "Provably fair: **on**")
+
+	if reply := slash("bob", "create", map[string]interface{}{"buyin": 100.0, "small": 1.0, "big": 2.0, "game": "poker"}); !strings.Contains(reply, "Unknown game") {
+		t.Errorf("Expected an unknown game to be refused, got %q", reply)
+	}
+
+	if reply := slash("alice", "stats", nil); !strings.Contains(reply, "Money: **$0**") {
+		t.Errorf("Expected alice's money to be at the table, got %q", reply)
+	}
+	if reply := slash("bob", "stats", map[string]interface{}{"player": "alice"}); !strings.Contains(reply, "Stats for **alice**") {
+		t.Errorf("Expected alice's stats, got %q", reply)
+	}
+
+	slash("alice", "leave", nil)
+	h.Expect("poker", "**alice** stoop up")
+}
+
+func TestTableView(t *testing.T) {
+	h := newHarness(t, testDeck)
+	defer h.Close()
+
+	h.Script("poker", "alice: create 100 1 2 / bob: join 100 / alice: conf set view on")
+	h.Expect("poker", "Table view: **on**")
+	h.Script("poker", "alice: start / alice: stop")
+	h.CheckDown("poker")
+	h.Expect("poker", "**Results**")
+	h.Expect("poker", "Stopped table")
+
+	// The board and the turns are only shown in the view, which is one message edited as the hand goes
+	h.chat.Lock()
+	defer h.chat.Unlock()
+	views := make(map[string]bool)
+	for _, m := range h.chat.Messages {
+		if m.View != "" {
+			views[m.View] = true
+		} else if m.File != "" || turnRegex.MatchString(m.Content) {
+			t.Errorf("Expected %q to only be in the view", m.Content)
+		}
+	}
+	if len(views) != 1 {
+		t.Errorf("Expected 1 view for the hand, got %d", len(views))
+	}
+}
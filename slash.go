@@ -0,0 +1,311 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/dutil/commandsystem"
+	"github.com/jonas747/joker/table"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Slash versions of the commands, they do the same as typing them. Synced with discord when the bot is ready
+var SlashCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "create",
+		Description: "Creates a table",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "buyin", Description: "Your buy in amount", Required: true},
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "small", Description: "Small stakes for this table", Required: true},
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "big", Description: "Big stakes for this table", Required: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "game", Description: "The game, holdem if not set", Autocomplete: true},
+		},
+	},
+	{
+		Name:        "join",
+		Description: "Joins the table in this channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "buyin", Description: "Buy in amount", Required: true},
+		},
+	},
+	{Name: "start", Description: "Starts the table"},
+	{Name: "stop", Description: "Stops the table after this hand"},
+	{Name: "leave", Description: "Leaves the table"},
+	{
+		Name:        "kick",
+		Description: "Kicks a player from your table",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionUser, Name: "player", Description: "Player to kick", Required: true},
+		},
+	},
+	{
+		Name:        "ban",
+		Description: "Bans a player from your table",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionUser, Name: "player", Description: "Player to ban", Required: true},
+		},
+	},
+	{
+		Name:        "config",
+		Description: "Shows or changes the table configuration",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "get", Description: "Shows the current config"},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Changes a config setting",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "key", Description: "What to change", Required: true, Autocomplete: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "value", Description: "The new value", Required: true, Autocomplete: true},
+				},
+			},
+		},
+	},
+	{
+		Name:        "stats",
+		Description: "Shows your or someone elses money and stats, only to you",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionUser, Name: "player", Description: "Someone else"},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "game", Description: "Only hands of this game", Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "stakes", Description: "Only hands at these stakes, like 10/20"},
+		},
+	},
+	{Name: "freemoney", Description: "Gives you $50 if you have less than that"},
+	{
+		Name:        "help",
+		Description: "Shows help about all or one command",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "command", Description: "The command", Autocomplete: true},
+		},
+	},
+}
+
+// An invoked slash command with its options by name, subcommands are part of the name like "config set"
+type slashInvocation struct {
+	Name    string
+	User    *discordgo.User
+	Channel string
+	Options map[string]*discordgo.ApplicationCommandInteractionDataOption
+}
+
+// Returns the option as a string, user options are the user id
+func (si *slashInvocation) Str(name string) string {
+	if opt, ok := si.Options[name]; ok {
+		str, _ := opt.Value.(string)
+		return str
+	}
+	return ""
+}
+
+func (si *slashInvocation) Int(name string) int {
+	if opt, ok := si.Options[name]; ok {
+		return int(opt.IntValue())
+	}
+	return 0
+}
+
+// Returns what to reply with and if only the user should see it
+type slashHandler func(si *slashInvocation) (reply string, private bool)
+
+// Table commands are answered in the channel by the table like the typed ones, so the reply is just for the user
+const slashSent = "👌"
+
+var slashHandlers = map[string]slashHandler{
+	"create": func(si *slashInvocation) (string, bool) {
+		game := table.Holdem
+		if si.Str("game") != "" {
+			var err error
+			game, err = ParseGame(si.Str("game"))
+			if err != nil {
+				return err.Error(), true
+			}
+		}
+
+		tableManager.EvtChan <- &CreateTableEvt{
+			PlayerID: si.User.ID,
+			Name:     si.User.Username,
+			Channel:  si.Channel,
+			BuyIn:    si.Int("buyin"),
+			Small:    si.Int("small"),
+			Big:      si.Int("big"),
+			Game:     game,
+		}
+		return slashSent, true
+	},
+	"join": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &AddPlayerEvt{PlayerID: si.User.ID, Name: si.User.Username, Channel: si.Channel, BuyIn: si.Int("buyin")}
+		return slashSent, true
+	},
+	"start": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &StartEvt{Channel: si.Channel}
+		return slashSent, true
+	},
+	"stop": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &StopTableEvt{PlayerID: si.User.ID, Channel: si.Channel}
+		return slashSent, true
+	},
+	"leave": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &RemovePlayerEvt{PlayerID: si.User.ID, Channel: si.Channel}
+		return slashSent, true
+	},
+	"kick": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &KickPlayerEvt{PlayerID: si.User.ID, KickPlayerID: si.Str("player"), Channel: si.Channel}
+		return slashSent, true
+	},
+	"ban": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &BanPlayerEvt{PlayerID: si.User.ID, BanPlayerID: si.Str("player"), Channel: si.Channel}
+		return slashSent, true
+	},
+	"config get": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &PrintInfoEvt{Channel: si.Channel}
+		return slashSent, true
+	},
+	"config set": func(si *slashInvocation) (string, bool) {
+		tableManager.EvtChan <- &ChangeSettingsEvt{Channel: si.Channel, PlayerID: si.User.ID, Settings: map[string]string{si.Str("key"): si.Str("value")}}
+		return slashSent, true
+	},
+	"stats": func(si *slashInvocation) (string, bool) {
+		user := si.User
+		if id := si.Str("player"); id != "" {
+			user = &discordgo.User{ID: id, Username: tableManager.Transport.UserName(id)}
+		}
+		filter := ParseStatsFilter([]string{si.Str("game"), si.Str("stakes")})
+		return StatsMessage(user.ID, user.Username, si.Channel, filter), true
+	},
+	"freemoney": func(si *slashInvocation) (string, bool) {
+		return FreeMoney(si.User.ID, si.User.Username, si.Channel), true
+	},
+	"help": func(si *slashInvocation) (string, bool) {
+		return HelpMessage(si.Str("command")), true
+	},
+}
+
+var syncSlashOnce sync.Once
+
+// Replaces the registered slash commands with SlashCommands, once per run since ready is sent again on reconnects
+func SyncSlashCommands(s *discordgo.Session) {
+	syncSlashOnce.Do(func() {
+		_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", SlashCommands)
+		if err != nil {
+			log.Println("Failed syncing slash commands:", err)
+		}
+	})
+}
+
+func HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		handleSlashCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handleAutocomplete(s, i)
+	}
+}
+
+func newSlashInvocation(i *discordgo.InteractionCreate) *slashInvocation {
+	data := i.ApplicationCommandData()
+	si := &slashInvocation{
+		Name:    data.Name,
+		Channel: i.ChannelID,
+		Options: make(map[string]*discordgo.ApplicationCommandInteractionDataOption),
+	}
+
+	si.User = i.User
+	if i.Member != nil {
+		si.User = i.Member.User
+	}
+
+	options := data.Options
+	if len(options) == 1 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		si.Name += " " + options[0].Name
+		options = options[0].Options
+	}
+	for _, opt := range options {
+		si.Options[opt.Name] = opt
+	}
+	return si
+}
+
+func handleSlashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	si := newSlashInvocation(i)
+	handler, ok := slashHandlers[si.Name]
+	if !ok {
+		log.Println("Unknown slash command", si.Name)
+		return
+	}
+
+	reply, private := handler(si)
+	data := &discordgo.InteractionResponseData{Content: reply}
+	if private {
+		data.Flags = discordgo.MessageFlagsEphemeral
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Println("Failed responding to slash command:", err)
+	}
+}
+
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	si := newSlashInvocation(i)
+
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, opt := range si.Options {
+		if opt.Focused {
+			focused = opt
+		}
+	}
+	if focused == nil {
+		return
+	}
+
+	suggestions := make([]string, 0)
+	switch focused.Name {
+	case "game":
+		suggestions = settingValues["game"]
+	case "key":
+		for k := range settingValues {
+			suggestions = append(suggestions, k)
+		}
+		sort.Strings(suggestions)
+	case "value":
+		suggestions = settingValues[strings.ToLower(si.Str("key"))]
+	case "command":
+		suggestions = commandNames(Commands)
+	}
+
+	typed := strings.ToLower(si.Str(focused.Name))
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, v := range suggestions {
+		// Discord shows at most 25
+		if strings.HasPrefix(strings.ToLower(v), typed) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: v, Value: v})
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Println("Failed responding to autocomplete:", err)
+	}
+}
+
+// Returns the names of the commands, lowercased like they're typed
+func commandNames(commands []commandsystem.CommandHandler) []string {
+	names := make([]string, 0)
+	for _, c := range commands {
+		switch cast := c.(type) {
+		case *commandsystem.SimpleCommand:
+			names = append(names, strings.ToLower(cast.Name))
+		case *commandsystem.CommandContainer:
+			names = append(names, strings.ToLower(cast.Name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jonas747/joker/table"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Aggregated stats for a player, for one game and stakes
+type PlayerStats struct {
+	Hands int
+
+	VPIP         int // Hands where money was put in voluntarily preflop
+	PFR          int // Hands raised preflop
+	Aggressive   int // Bets and raises
+	Calls        int
+	SawFlop      int // Hands that got past the first betting round
+	Showdowns    int
+	WonShowdowns int
+
+	BiggestPot int
+	Net        int     // Cash game chips won minus chips put in
+	NetBB      float64 // Net in big blinds, for bb/100
+	CashHands  int
+}
+
+func (s *PlayerStats) Merge(o *PlayerStats) {
+	s.Hands += o.Hands
+	s.VPIP += o.VPIP
+	s.PFR += o.PFR
+	s.Aggressive += o.Aggressive
+	s.Calls += o.Calls
+	s.SawFlop += o.SawFlop
+	s.Showdowns += o.Showdowns
+	s.WonShowdowns += o.WonShowdowns
+	if o.BiggestPot > s.BiggestPot {
+		s.BiggestPot = o.BiggestPot
+	}
+	s.Net += o.Net
+	s.NetBB += o.NetBB
+	s.CashHands += o.CashHands
+}
+
+func percent(n, of int) string {
+	if of < 1 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(of))
+}
+
+func (s *PlayerStats) String() string {
+	af := "-"
+	if s.Calls > 0 {
+		af = fmt.Sprintf("%.2f", float64(s.Aggressive)/float64(s.Calls))
+	} else if s.Aggressive > 0 {
+		af = "∞"
+	}
+
+	bb100 := "-"
+	if s.CashHands > 0 {
+		bb100 = fmt.Sprintf("%.2f", s.NetBB*100/float64(s.CashHands))
+	}
+
+	return fmt.Sprintf(" - Hands: **%d**\n - VPIP: **%s**\n - PFR: **%s**\n - AF: **%s**\n - WTSD: **%s**\n - W$SD: **%s**\n - Biggest pot won: **%d**\n - Net: **%+d**\n - bb/100: **%s**",
+		s.Hands, percent(s.VPIP, s.Hands), percent(s.PFR, s.Hands), af, percent(s.Showdowns, s.SawFlop), percent(s.WonShowdowns, s.Showdowns),
+		s.BiggestPot, s.Net, bb100)
+}
+
+type statsKey struct {
+	PlayerID string
+	Game     table.Game
+	Stakes   string
+}
+
+// StatsFilter limits stats to a game and/or stakes, empty fields matches everything
+type StatsFilter struct {
+	Game   table.Game
+	Stakes string
+}
+
+func (f *StatsFilter) String() string {
+	parts := make([]string, 0)
+	if f.Game != "" {
+		parts = append(parts, string(f.Game))
+	}
+	if f.Stakes != "" {
+		parts = append(parts, f.Stakes)
+	}
+	return strings.Join(parts, " ")
+}
+
+var stakesRegex = regexp.MustCompile(`^\d+/\d+$`)
+
+// Parses filters like "holdem 10/20", words that aren't filters are ignored
+func ParseStatsFilter(words []string) *StatsFilter {
+	filter := &StatsFilter{}
+	for _, word := range words {
+		if stakesRegex.MatchString(word) {
+			filter.Stakes = word
+		} else if game, err := ParseGame(word); err == nil {
+			filter.Game = game
+		}
+	}
+	return filter
+}
+
+// HandStats keeps per player aggregates, updated as hands are recorded
+type HandStats struct {
+	sync.Mutex
+	stats map[statsKey]*PlayerStats
+}
+
+func NewHandStats() *HandStats {
+	return &HandStats{stats: make(map[statsKey]*PlayerStats)}
+}
+
+func (hs *HandStats) Add(h *HandHistory) {
+	stakes := fmt.Sprintf("%d/%d", h.Stakes.SmallBet, h.Stakes.BigBet)
+
+	// Figure out how far the hand got and who folded
+	folded := make(map[int]bool)
+	put := make(map[int]int)
+	lastStreet := 0
+	for _, a := range h.Actions {
+		put[a.Seat] += a.Amount
+		if a.Action == string(table.Fold) {
+			folded[a.Seat] = true
+		}
+		if a.Street > lastStreet {
+			lastStreet = a.Street
+		}
+	}
+	if len(h.Board) >= 3 && len(h.Board)-2 > lastStreet {
+		lastStreet = len(h.Board) - 2
+	}
+	for _, p := range h.Players {
+		if IsStud(h.Game) && len(p.Cards)-3 > lastStreet {
+			lastStreet = len(p.Cards) - 3
+		}
+	}
+	showdown := len(h.Players)-len(folded) > 1
+
+	won := make(map[int]int)
+	for _, r := range h.Results {
+		won[r.Seat] += r.Chips
+	}
+
+	hs.Lock()
+	defer hs.Unlock()
+
+	for _, p := range h.Players {
+		key := statsKey{PlayerID: p.ID, Game: h.Game, Stakes: stakes}
+		s, ok := hs.stats[key]
+		if !ok {
+			s = &PlayerStats{}
+			hs.stats[key] = s
+		}
+
+		s.Hands++
+
+		vpip, pfr := false, false
+		foldedPreflop := false
+		for _, a := range h.Actions {
+			if a.Seat != p.Seat {
+				continue
+			}
+
+			switch a.Action {
+			case string(table.Call):
+				s.Calls++
+				if a.Street == 0 {
+					vpip = true
+				}
+			case string(table.Bet), string(table.Raise):
+				s.Aggressive++
+				if a.Street == 0 {
+					vpip, pfr = true, true
+				}
+			case string(table.Fold):
+				foldedPreflop = a.Street == 0
+			}
+		}
+		if vpip {
+			s.VPIP++
+		}
+		if pfr {
+			s.PFR++
+		}
+
+		if lastStreet > 0 && !foldedPreflop {
+			s.SawFlop++
+			if showdown && !folded[p.Seat] {
+				s.Showdowns++
+				if won[p.Seat] > 0 {
+					s.WonShowdowns++
+				}
+			}
+		}
+
+		if won[p.Seat] > s.BiggestPot {
+			s.BiggestPot = won[p.Seat]
+		}
+
+		if !h.Tournament {
+			net := won[p.Seat] - put[p.Seat]
+			s.Net += net
+			s.CashHands++
+			if h.Stakes.BigBet > 0 {
+				s.NetBB += float64(net) / float64(h.Stakes.BigBet)
+			}
+		}
+	}
+}
+
+// Returns the stats for the player that matches the filter
+func (hs *HandStats) Get(playerID string, filter *StatsFilter) *PlayerStats {
+	hs.Lock()
+	defer hs.Unlock()
+
+	out := &PlayerStats{}
+	for key, s := range hs.stats {
+		if key.PlayerID != playerID {
+			continue
+		}
+		if filter.Game != "" && key.Game != filter.Game {
+			continue
+		}
+		if filter.Stakes != "" && key.Stakes != filter.Stakes {
+			continue
+		}
+		out.Merge(s)
+	}
+	return out
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// PlayerStore is where player data gets persisted, every change to a player is committed
+// through Save so that nothing is lost if the bot crashes
+type PlayerStore interface {
+	// Load returns all stored players
+	Load() ([]*Player, error)
+
+	// Save commits a single player, the caller should hold the players lock
+	Save(player *Player) error
+
+	// SaveAll commits all the players in one go, used by the importer
+	SaveAll(players []*Player) error
+
+	Close() error
+}
+
+// The on disk representation of a player, same fields as the old players.json plus the leaderboard counters
+type storedPlayer struct {
+	ID      string
+	Name    string
+	Money   int
+	Wallets map[string]int `json:",omitempty"`
+	Guilds  []string       `json:",omitempty"`
+	Hands   int            `json:",omitempty"`
+	Profit  int            `json:",omitempty"`
+	Prizes  int            `json:",omitempty"`
+
+	CardStyle string `json:",omitempty"`
+}
+
+func newStoredPlayer(p *Player) *storedPlayer {
+	wallets := make(map[string]int)
+	for k, v := range p.Wallets {
+		wallets[k] = v
+	}
+
+	return &storedPlayer{
+		ID:      p.ID,
+		Name:    p.Name,
+		Money:   p.Money,
+		Wallets: wallets,
+		Guilds:  p.Guilds,
+		Hands:   p.Hands,
+		Profit:  p.Profit,
+		Prizes:  p.Prizes,
+
+		CardStyle: p.CardStyle,
+	}
+}
+
+func (s *storedPlayer) Player() *Player {
+	return &Player{
+		ID:      s.ID,
+		Name:    s.Name,
+		Money:   s.Money,
+		Wallets: s.Wallets,
+		Guilds:  s.Guilds,
+		Hands:   s.Hands,
+		Profit:  s.Profit,
+		Prizes:  s.Prizes,
+
+		CardStyle: s.CardStyle,
+	}
+}
+
+// OpenPlayerStore opens a store of the specified kind ("bolt" or "json")
+func OpenPlayerStore(kind, path string) (PlayerStore, error) {
+	switch kind {
+	case "bolt":
+		return NewBoltPlayerStore(path)
+	case "json":
+		return NewJSONPlayerStore(path), nil
+	}
+	return nil, errors.New("Unknown store type " + kind)
+}
+
+// ImportPlayersJSON reads a players.json file and commits all the players in it to the store
+func ImportPlayersJSON(path string, store PlayerStore) (int, error) {
+	players, err := readPlayersJSON(path)
+	if err != nil {
+		return 0, err
+	}
+
+	err = store.SaveAll(players)
+	if err != nil {
+		return 0, err
+	}
+	return len(players), nil
+}
+
+func readPlayersJSON(path string) ([]*Player, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded []*storedPlayer
+	err = json.Unmarshal(file, &decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	players := make([]*Player, len(decoded))
+	for k, v := range decoded {
+		players[k] = v.Player()
+	}
+	return players, nil
+}
+
+// JSONPlayerStore keeps the old players.json format, the whole file is rewritten
+// on every change and swapped in place with a rename so it is never left half written
+type JSONPlayerStore struct {
+	sync.Mutex
+	Path string
+
+	players []*storedPlayer
+	index   map[string]int
+}
+
+func NewJSONPlayerStore(path string) *JSONPlayerStore {
+	return &JSONPlayerStore{
+		Path:  path,
+		index: make(map[string]int),
+	}
+}
+
+func (s *JSONPlayerStore) Load() ([]*Player, error) {
+	players, err := readPlayersJSON(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Player{}, nil
+		}
+		return nil, err
+	}
+
+	s.Lock()
+	s.players = make([]*storedPlayer, 0, len(players))
+	s.index = make(map[string]int)
+	for _, p := range players {
+		s.set(p)
+	}
+	s.Unlock()
+
+	return players, nil
+}
+
+func (s *JSONPlayerStore) set(p *Player) {
+	if i, ok := s.index[p.ID]; ok {
+		s.players[i] = newStoredPlayer(p)
+		return
+	}
+	s.index[p.ID] = len(s.players)
+	s.players = append(s.players, newStoredPlayer(p))
+}
+
+func (s *JSONPlayerStore) Save(player *Player) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.set(player)
+	return s.write()
+}
+
+func (s *JSONPlayerStore) SaveAll(players []*Player) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, p := range players {
+		s.set(p)
+	}
+	return s.write()
+}
+
+func (s *JSONPlayerStore) write() error {
+	out, err := json.Marshal(s.players)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.Path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(out)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.Path)
+}
+
+func (s *JSONPlayerStore) Close() error {
+	return nil
+}
+
+var playersBucket = []byte("players")
+
+// BoltPlayerStore stores players in a bolt database, each save is its own transaction
+type BoltPlayerStore struct {
+	db *bolt.DB
+}
+
+func NewBoltPlayerStore(path string) (*BoltPlayerStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(playersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltPlayerStore{db: db}, nil
+}
+
+func (s *BoltPlayerStore) Load() ([]*Player, error) {
+	players := make([]*Player, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(playersBucket).ForEach(func(k, v []byte) error {
+			var decoded *storedPlayer
+			err := json.Unmarshal(v, &decoded)
+			if err != nil {
+				return err
+			}
+			players = append(players, decoded.Player())
+			return nil
+		})
+	})
+	return players, err
+}
+
+func (s *BoltPlayerStore) Save(player *Player) error {
+	return s.SaveAll([]*Player{player})
+}
+
+func (s *BoltPlayerStore) SaveAll(players []*Player) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(playersBucket)
+		for _, p := range players {
+			encoded, err := json.Marshal(newStoredPlayer(p))
+			if err != nil {
+				return err
+			}
+
+			err = bucket.Put([]byte(p.ID), encoded)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltPlayerStore) Close() error {
+	return s.db.Close()
+}
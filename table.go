@@ -25,6 +25,7 @@ type Table struct {
 	sync.Mutex
 	Table   *table.Table
 	Manager *TableManager
+	Dealer  hand.Dealer // Deals the decks, they're recorded if it's a RecordingDealer
 
 	Owner     string
 	OwnerName string
@@ -36,13 +37,44 @@ type Table struct {
 
 	BannedPlayers []string // Banned player ids
 
-	hasSentCards      bool
+	Bank string // Bank buy ins are taken from and cash outs go to, decided when the table is created
+
+	Cards CardPrefs // How the board is shown, and hole cards to players that didn't pick a style
+
+	View       bool // Show each hand in one message that's edited as it goes instead of a message for everything
+	liveView   *liveView
+	viewStatus *viewStatus
+	viewFresh  bool // Set when the next view update should be a new message
+
+	Tournament *Tournament           // Set if this is a tournament table
+	MTT        *MultiTableTournament // Set if this is one of the tables in a multi table tournament
+	Blinds     *BlindSchedule        // Set if the blinds go up automatically
+
+	Hands  int  // Number of hands started at this table
+	inHand bool // True while a hand is being played
+	Chips  int  // Chips brought to the table minus chips taken from it, used to check nothing got lost
+
 	printedBoardState int
+	printedUpCards    int // Number of face up stud cards printed
+	printedOdds       int // Number of known cards when the all in odds were last posted
+
+	history       *HandHistory   // The hand being played
+	pendingAction *HistoryAction // Last action a player made, the chips are filled in once the table handled it
 
 	stopAfterDone      bool // Set to true to stop the table
 	serverShuttingDown bool // If set will also destroy the table when stopping
 }
 
+// Sends a message to the table channel
+func (t *Table) Send(msg string) {
+	t.Manager.Send(t.Channel, msg)
+}
+
+// Sends a message with controls to the table channel
+func (t *Table) SendControls(msg string, controls []*Control) {
+	t.Manager.Transport.SendControls(t.Channel, msg, controls)
+}
+
 func (t *Table) IsPlayerBanned(id string) bool {
 	for _, v := range t.BannedPlayers {
 		if v == id {
@@ -52,18 +84,32 @@ func (t *Table) IsPlayerBanned(id string) bool {
 	return false
 }
 
+// Marks the table as running and runs it in the background, table should be locked. Running is set before
+// letting go of the lock so nothing else can start another loop on the same table
+func (t *Table) Start() {
+	t.Running = true
+	if t.Tournament != nil {
+		t.Tournament.Started = true
+	}
+	go t.Run()
+}
+
+// Plays hands until the table is stopped, use Start so it's marked as running first
 func (t *Table) Run() {
 	t.Lock()
 
-	t.Running = true
-	go SurelySend(t.Channel, "Started table")
+	t.Send("Started table")
+	t.announceCommitment()
+	t.resumeBlinds()
 
 	t.run()
 
+	t.pauseBlinds()
 	t.Running = false
+	t.notifyMTT()
 
 	t.Unlock()
-	SurelySend(t.Channel, "Stopped table")
+	t.Send("Stopped table")
 	t.emptyChannel()
 }
 
@@ -82,15 +128,61 @@ func (t *Table) emptyChannel() {
 // Run the tableee
 func (t *Table) run() {
 	for {
+		stacks := t.stacks()
 		results, done, err := t.Table.Next()
+		t.recordHistory(stacks, results, done)
+
+		resultsStr := ""
+		if results != nil {
+			resultsStr = t.printResults(results)
+			t.UpdateView("**Results**\n"+resultsStr, nil, time.Time{})
+		}
+
+		if results != nil && t.MTT != nil {
+			t.EliminateBusted()
+		}
+
+		if results != nil && t.Tournament != nil {
+			t.EliminateBusted()
+			if len(t.Table.Players()) < 2 {
+				t.inHand = false
+				t.Send("Results:\n" + resultsStr)
+				t.FinishTournament()
+				return
+			}
+		}
+
 		if done || (results != nil && t.stopAfterDone) {
+			if results != nil {
+				t.inHand = false
+				t.CheckChips()
+			}
+
 			if t.serverShuttingDown {
+				// Cash out the ones that wanted to leave and save the rest for when we're back up
 				for _, v := range t.Table.Players() {
-					cast := v.Player().(*TablePlayer)
-					GiveMoney(cast.Id, cast.Name, v.Chips())
+					cast := asTablePlayer(v.Player())
+					if cast.LeaveAfterFold && t.IsTournament() {
+						t.Eliminate(v)
+					} else if cast.LeaveAfterFold {
+						t.CashOut(v)
+					}
+				}
+				t.RemoveBots()
+				t.pauseBlinds()
+
+				// Multi table tournaments are split up by chip count instead of saved
+				var snapshot *TableSnapshot
+				if t.MTT != nil {
+					t.MTT.RecordChop(t)
+				} else {
+					snapshot = t.Snapshot()
 				}
+
 				// Remove it from tablemanager
-				tableManager.EvtChan <- &DestroyTableEvt{Channel: t.Channel}
+				go func() {
+					tableManager.EvtChan <- &DestroyTableEvt{Channel: t.Channel, Snapshot: snapshot}
+				}()
 			}
 
 			if results != nil {
@@ -100,67 +192,188 @@ func (t *Table) run() {
 				} else if t.stopAfterDone {
 					msgText = "Someone stopped the table..."
 				}
-				SurelySend(t.Channel, "Results:\n"+t.printResults(results)+"\n\n Reason table stopped: **"+msgText+"**")
+				t.Send("Results:\n" + resultsStr + "\n\n Reason table stopped: **" + msgText + "**")
 			}
 
 			return
 		}
 
+		if results == nil && !t.inHand {
+			t.Hands++
+			t.inHand = true
+			t.newView()
+		}
+
 		if results != nil {
-			t.hasSentCards = false
+			t.inHand = false
 			t.printedBoardState = 0
-			go SurelySend(t.Channel, "Results:\n"+t.printResults(results)+"\nStarting next hand in 10 seconds")
+			t.printedUpCards = 0
+			t.printedOdds = 0
+			for _, v := range t.Table.Players() {
+				asTablePlayer(v.Player()).sentCards = 0
+			}
+			t.Send(fmt.Sprintf("Results:\n%s\nStarting next hand in %s", resultsStr, t.Manager.handDelay()))
+			t.announceCommitment()
 		}
 
 		if err != nil {
 			log.Println("Error", err)
-			go SurelySend(t.Channel, "Error "+err.Error())
+			t.Send("Error " + err.Error())
 		}
 
 		if results == nil {
 			t.MaybeSendTable()
+			t.MaybeSendOdds()
+			t.UpdateView("", nil, time.Time{})
 		}
 
 		for _, v := range t.Table.Players() {
-			player := v.Player().(*TablePlayer)
+			player := asTablePlayer(v.Player())
 			if player.LeaveAfterFold && (player.foldedAndReadyToLeave || results != nil) {
-				money := v.Chips()
-				t.Table.Stand(v.Player())
+				if t.IsTournament() {
+					t.Eliminate(v)
+					continue
+				}
+
+				t.CashOut(v)
 				t.CheckReplaceOwner()
 
-				go GiveMoney(player.Id, player.Name, money)
-				go SurelySend(t.Channel, fmt.Sprintf("%s stood up", player.Name))
+				if t.viewing() {
+					t.RefreshView()
+				} else {
+					t.Send(fmt.Sprintf("%s stood up", player.Name))
+				}
 			}
 		}
+		if t.Humans() < 1 {
+			t.RemoveBots()
+		}
 
 		// Sleep at the end and maybe send cards
 		if results != nil {
+			t.advanceBlinds()
+			t.CheckChips()
+			go func() {
+				t.Manager.EvtChan <- &AuditEvt{}
+			}()
+			t.notifyMTT()
+
 			t.Unlock()
-			time.Sleep(time.Second * 10) // take a nap zzzzz
+			time.Sleep(t.Manager.handDelay()) // take a nap zzzzz
 			t.Lock()
-		} else if !t.hasSentCards {
+		} else {
 			t.SendPlayerCards()
-			t.hasSentCards = true
 		}
 	}
 }
 
+// Seats the player and keeps track of the chips brought to the table
+func (t *Table) Sit(tp table.Player, seat, chips int) error {
+	err := t.Table.Sit(tp, seat, chips)
+	if err == nil {
+		t.Chips += chips
+	}
+	return err
+}
+
+// Stands the player up and gives the chips back to the player, or the house if it's a bot
+func (t *Table) CashOut(p *table.PlayerState) {
+	tablePlayer := asTablePlayer(p.Player())
+	chips := t.Stand(p)
+	if IsBot(tablePlayer.Id) {
+		t.houseMoney(tablePlayer.Id, -chips, ReasonHouseCashOut)
+		return
+	}
+	GiveMoney(tablePlayer.Id, tablePlayer.Name, chips, t.MoneySource(ReasonCashOut))
+}
+
+// Stands the player up and returns the chips he left with
+func (t *Table) Stand(p *table.PlayerState) int {
+	chips := p.Chips()
+	t.Table.Stand(p.Player())
+	t.Chips -= chips
+	return chips
+}
+
+// Returns the money sitting at the table, for tournaments the chips are not worth anything so it's the prize pool.
+// Multi table tournaments keep their prize pool away from the tables.
+func (t *Table) MoneyAtTable() int {
+	if t.Tournament != nil {
+		return t.Tournament.Pool
+	}
+	if t.MTT != nil {
+		return 0
+	}
+	return t.ChipsInPlay()
+}
+
+// Returns a money source for money moving between players and the table
+func (t *Table) MoneySource(reason string) MoneySource {
+	return MoneySource{Reason: reason, Channel: t.Channel, Hand: t.Hands, Bank: t.Bank}
+}
+
+func (t *Table) IsTournament() bool {
+	return t.Tournament != nil || t.MTT != nil
+}
+
+// Lets the multi table tournament coordinator know it can move players around
+func (t *Table) notifyMTT() {
+	if t.MTT == nil {
+		return
+	}
+
+	go func() {
+		t.Manager.EvtChan <- &MTTUpdateEvt{MTT: t.MTT}
+	}()
+}
+
+// Returns all the chips at the table, including the pot if a hand is being played
+func (t *Table) ChipsInPlay() int {
+	chips := 0
+	for _, p := range t.Table.Players() {
+		chips += p.Chips()
+	}
+	if t.inHand {
+		chips += t.Table.Pot().Chips()
+	}
+	return chips
+}
+
+// Checks that the chips at the table add up to what was brought to it
+func (t *Table) CheckChips() {
+	inPlay := t.ChipsInPlay()
+	if inPlay != t.Chips {
+		msg := fmt.Sprintf("Chip drift at table <#%s> after hand %d: %d chips at the table, expected %d", t.Channel, t.Hands, inPlay, t.Chips)
+		log.Println(msg)
+		t.Manager.AlertOwner(msg)
+	}
+}
+
+// Sends players their cards, in stud games cards are dealt every street so this only sends if they got new ones
 func (t *Table) SendPlayerCards() {
 	for _, player := range t.Table.Players() {
 		if player.Out() || player.Chips() < 1 {
 			continue
 		}
 
-		tablePlayer, ok := player.Player().(*TablePlayer)
-		if !ok {
-			panic("Failed casting to tableplayer??")
+		tablePlayer := asTablePlayer(player.Player())
+		if IsBot(tablePlayer.Id) {
+			continue
+		}
+
+		if len(player.HoleCards()) > tablePlayer.sentCards {
+			tablePlayer.SendCards(player)
+			tablePlayer.sentCards = len(player.HoleCards())
 		}
-		tablePlayer.SendCards(player)
 	}
 }
 
 // Checks if the owner of the table is at the table, if not replace him
 func (t *Table) CheckReplaceOwner() {
+	if t.MTT != nil {
+		return // Tournament tables don't have an owner
+	}
+
 	for _, p := range t.Table.Players() {
 		id := p.Player().ID()
 		if id == t.Owner {
@@ -170,35 +383,93 @@ func (t *Table) CheckReplaceOwner() {
 
 	// Owner not at the table, assign a new one
 	for _, p := range t.Table.Players() {
+		if IsBot(p.Player().ID()) {
+			continue
+		}
+
 		t.Owner = p.Player().ID()
-		cast := p.Player().(*TablePlayer)
+		cast := asTablePlayer(p.Player())
 		t.OwnerName = cast.Name
-		go SurelySend(t.Channel, "New owner for table: "+cast.Name)
+		t.Send("New owner for table: " + cast.Name)
 		return
 	}
 }
 
-// Sends the table if it has changed
+// Sends the table if it has changed, the table view shows it instead if that's on
 func (t *Table) MaybeSendTable() {
+	if t.viewing() {
+		return
+	}
+
+	if IsStud(t.Table.Game()) {
+		t.maybeSendUpCards()
+		return
+	}
 
 	board := t.Table.Board()
 	if len(board) > 0 && t.printedBoardState < len(board) {
+		_, boardSize := gameCards(t.Table.Game())
+		SendCards(t.Manager.Transport, t.Channel, "", "Board", cardsString(board), board, boardSize, t.Cards)
+		t.printedBoardState = len(board)
+	}
+}
 
-		cardsStr := "["
-		for k, c := range board {
-			if k != 0 {
-				cardsStr += ", "
+// Stud games have no board, instead some of the players cards are dealt face up
+func (t *Table) maybeSendUpCards() {
+	upCards := 0
+	out := ""
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		player, ok := t.Table.Players()[seat]
+		if !ok || player.Out() {
+			continue
+		}
+
+		cards := make([]*hand.Card, 0)
+		for _, hc := range player.HoleCards() {
+			if hc.Visibility == table.Exposed {
+				cards = append(cards, hc.Card)
 			}
-			cardsStr += string(c.Rank()) + " " + string(c.Suit())
 		}
-		cardsStr += "]"
+		if len(cards) < 1 {
+			continue
+		}
+		upCards += len(cards)
 
-		go SurelySend(t.Channel, fmt.Sprintf("Board\n```\n%s\n```\n%s", createAsciiCards(board, " "), cardsStr))
-		t.printedBoardState = len(board)
+		tablePlayer := asTablePlayer(player.Player())
+		out += fmt.Sprintf("%s: %s\n", tablePlayer.Name, cardsString(cards))
+	}
+
+	if upCards > t.printedUpCards {
+		t.Send("Face up cards\n" + out)
+		t.printedUpCards = upCards
 	}
 }
 
+// Settings conf set understands, with values worth suggesting
+var settingValues = map[string][]string{
+	"small":     nil,
+	"big":       nil,
+	"ante":      nil,
+	"limit":     {"nolimit", "potlimit", "fixedlimit"},
+	"seats":     nil,
+	"timeout":   nil,
+	"fair":      {"on", "off"},
+	"blinds":    {"off"},
+	"prizes":    nil,
+	"stack":     nil,
+	"game":      {"holdem", "omaha", "omahahilo", "stud", "studhilo", "razz"},
+	"cards":     {StyleImage, StyleASCII, StyleEmoji},
+	"fourcolor": {"on", "off"},
+	"back":      CardThemes("backs"),
+	"felt":      CardThemes("felts"),
+	"view":      {"on", "off"},
+}
+
 func (t *Table) ChangeSetting(key string, strVal string) {
+	if t.TournamentStarted() && tournamentLockedSettings[strings.ToLower(key)] {
+		t.Send("Can't change " + key + " after the tournament started")
+		return
+	}
 
 	trimmed := strings.TrimSpace(strVal)
 
@@ -227,8 +498,91 @@ func (t *Table) ChangeSetting(key string, strVal string) {
 		currentConfig.NumOfSeats = intVal
 	case "timeout":
 		t.TimeOut = intVal
+	case "fair", "provablyfair":
+		switch strings.ToLower(trimmed) {
+		case "on", "yes", "true":
+			t.SetFair(true)
+			t.announceCommitment() // So there's time to add entropy before the first hand
+		case "off", "no", "false":
+			t.SetFair(false)
+		}
+	case "blinds", "schedule":
+		if strings.ToLower(trimmed) == "off" {
+			t.Blinds = nil
+			break
+		}
+
+		schedule, err := ParseBlindSchedule(trimmed, currentConfig.Stakes.SmallBet)
+		if err != nil {
+			t.Send(err.Error())
+			break
+		}
+
+		t.Blinds = schedule
+		level := schedule.Current()
+		currentConfig.Stakes = table.Stakes{SmallBet: level.Small, BigBet: level.Big, Ante: level.Ante}
+	case "prizes":
+		if t.Tournament == nil {
+			t.Send("This is not a tournament table")
+			break
+		}
+
+		prizes, err := ParsePrizes(trimmed, t.Table.NumOfSeats())
+		if err != nil {
+			t.Send(err.Error())
+		} else {
+			t.Tournament.Prizes = prizes
+		}
+	case "stack":
+		if t.Tournament == nil || t.Tournament.Started {
+			t.Send("Starting stack can only be changed before a tournament starts")
+		} else if intVal < 1 {
+			t.Send("Starting stack has to be atleast 1")
+		} else {
+			t.setTournamentStack(intVal)
+		}
 	case "game":
-		go SurelySend(t.Channel, "TODO")
+		game, err := ParseGame(trimmed)
+		if err != nil {
+			t.Send(err.Error())
+		} else {
+			currentConfig.Game = game
+		}
+	case "cards", "style":
+		style, err := ParseCardStyle(trimmed)
+		if err != nil {
+			t.Send(err.Error())
+		} else {
+			t.Cards.Style = style
+		}
+	case "fourcolor", "fourcolour":
+		switch strings.ToLower(trimmed) {
+		case "on", "yes", "true":
+			t.Cards.FourColor = true
+		case "off", "no", "false":
+			t.Cards.FourColor = false
+		}
+	case "back":
+		back, err := ParseCardTheme("backs", trimmed)
+		if err != nil {
+			t.Send(err.Error())
+		} else {
+			t.Cards.Back = back
+		}
+	case "felt":
+		felt, err := ParseCardTheme("felts", trimmed)
+		if err != nil {
+			t.Send(err.Error())
+		} else {
+			t.Cards.Felt = felt
+		}
+	case "view":
+		switch strings.ToLower(trimmed) {
+		case "on", "yes", "true":
+			t.View = true
+		case "off", "no", "false":
+			t.View = false
+		}
 	}
 
 	t.Table.SetConfig(currentConfig)
@@ -253,25 +607,39 @@ func (t *Table) RemovePlayer(id string, kicked bool) error {
 		return errors.New("Player not found")
 	}
 
-	tablePlayer := p.Player().(*TablePlayer)
+	tablePlayer := asTablePlayer(p.Player())
 
 	if t.Running && !p.Out() {
 		tablePlayer.LeaveAfterFold = true
 		if kicked {
 			tablePlayer.AutoFold = true
 		}
-		go SurelySend(t.Channel, "Leaving after round (fold if you just want to begone)")
+		t.Send("Leaving after round (fold if you just want to begone)")
+	} else if t.MTT != nil {
+		t.Eliminate(p)
+	} else if t.Tournament != nil {
+		t.LeaveTournament(p)
+		if len(t.Table.Players()) < 1 {
+			go func() {
+				t.Manager.EvtChan <- &DestroyTableEvt{Channel: t.Channel}
+			}()
+		}
 	} else {
-		t.Table.Stand(p.Player())
-		go SurelySend(t.Channel, "**"+tablePlayer.Name+"** stoop up")
+		t.CashOut(p)
+		t.Send("**" + tablePlayer.Name + "** stoop up")
 		t.CheckReplaceOwner()
+
+		// Bots don't play on their own
+		if t.Humans() < 1 {
+			t.RemoveBots()
+		}
+
 		// Destroy it
 		if len(t.Table.Players()) < 1 {
 			go func() {
 				t.Manager.EvtChan <- &DestroyTableEvt{Channel: t.Channel}
 			}()
 		}
-		go GiveMoney(id, tablePlayer.Name, p.Chips())
 	}
 	return nil
 }
@@ -280,11 +648,11 @@ type TablePlayer struct {
 	Table          *Table
 	Id             string
 	Name           string
-	PrivateChannel string
 	LeaveAfterFold bool // Player will leave after folding
 	AutoFold       bool // Set to true to force fold on players turn
 
 	foldedAndReadyToLeave bool
+	sentCards             int // Number of hole cards sent to the player this hand
 }
 
 func (p *TablePlayer) ID() string {
@@ -295,7 +663,22 @@ func (p *TablePlayer) FromID(id string) (table.Player, error) {
 	return &TablePlayer{Id: p.Id}, nil
 }
 
+// Action asks the player what to do and records it in the hand history
 func (p *TablePlayer) Action() (table.Action, int) {
+	return p.recordAction(p.action)
+}
+
+// Records what decide came up with in the hand history
+func (p *TablePlayer) recordAction(decide func() (table.Action, int)) (table.Action, int) {
+	current := p.Table.Table.CurrentPlayer()
+	street := p.Table.street()
+
+	action, chips := decide()
+	p.Table.pendingAction = &HistoryAction{Street: street, Seat: current.Seat(), Action: string(action), Chips: chips}
+	return action, chips
+}
+
+func (p *TablePlayer) action() (table.Action, int) {
 
 	current := p.Table.Table.CurrentPlayer()
 
@@ -317,11 +700,21 @@ func (p *TablePlayer) Action() (table.Action, int) {
 	min := p.Table.Table.MinRaise() // - outstanding
 	max := p.Table.Table.MaxRaise() // - outstanding
 
-	go SurelySend(p.Table.Channel, fmt.Sprintf("<@%s>'s Turn, Chips: %d, MinRaise: %d, MaxRaise: %d, Actions: **%s**, Pot: **%d**",
-		p.Id, current.Chips(), min, max, actions, p.Table.Table.Pot().Chips()))
+	// Before the turn is shown so a quick answer isn't missed
+	p.Table.Manager.StartTurn(p.Table.Channel, p.Id)
+	defer p.Table.Manager.EndTurn(p.Table.Channel)
+
+	timeout := time.Second * time.Duration(p.Table.GetTimeout())
+	turnMsg := fmt.Sprintf("<@%s>'s Turn, Chips: %d, MinRaise: %d, MaxRaise: %d, Actions: **%s**, Pot: **%d**",
+		p.Id, current.Chips(), min, max, actions, p.Table.Table.Pot().Chips())
+	if p.Table.viewing() {
+		p.Table.UpdateView(turnMsg, turnControls(validActions), time.Now().Add(timeout))
+	} else {
+		p.Table.SendControls(turnMsg, turnControls(validActions))
+	}
 
 	// Fold automatically after timeout
-	after := time.After(time.Second * time.Duration(p.Table.GetTimeout()))
+	after := time.After(timeout)
 
 MAINLOOP:
 	for {
@@ -358,6 +751,12 @@ MAINLOOP:
 		}
 		p.Table.Lock()
 
+		if action.AskAmount {
+			p.Table.Manager.PromptAmount(p.Table.Channel)
+			p.Table.Send(fmt.Sprintf("<@%s> how much? Type the amount, like `%d`, `pot` or `3x`", p.Id, min))
+			continue
+		}
+
 		// parse action
 		found := false
 		if action.IsTableAction {
@@ -366,6 +765,13 @@ MAINLOOP:
 					found = true
 				}
 			}
+
+			if !found {
+				if other, ok := betOrRaise(action.TableAction, validActions); ok {
+					action = &Action{IsTableAction: true, TableAction: other, RestMessage: action.RestMessage}
+					found = true
+				}
+			}
 		}
 
 		chipAmountSet := false
@@ -391,7 +797,7 @@ MAINLOOP:
 
 		// Not a valid action
 		if !found {
-			go SurelySend(p.Table.Channel, "You can't do that")
+			p.Table.Send("You can't do that")
 			continue
 		}
 
@@ -403,24 +809,13 @@ MAINLOOP:
 		}
 
 		if !chipAmountSet {
-
-			if action.RestMessage == "" {
-				go SurelySend(p.Table.Channel, "Try again by also specifying amount")
-				continue
-			}
-
-			chips, err := strconv.ParseInt(action.RestMessage, 10, 64)
+			chips, err := ResolveBet(action.RestMessage, p.Table.betContext())
 			if err != nil {
-				go SurelySend(p.Table.Channel, "Failed parsing number >:O")
-				continue
-			}
-			if chips <= 0 {
-				go SurelySend(p.Table.Channel, "Can't raise/bet anythign less then 1 >:(")
+				p.Table.Send(err.Error())
 				continue
 			}
 
-			chipAmount = int(chips)
-
+			chipAmount = chips
 		}
 
 		return action.TableAction, chipAmount
@@ -429,7 +824,44 @@ MAINLOOP:
 	return table.Fold, 0
 }
 
+// Controls for what the player can do, pressing one is the same as typing the command
+func turnControls(valid []table.Action) []*Control {
+	controls := make([]*Control, 0)
+	canRaise := false
+	for _, v := range valid {
+		switch v {
+		case table.Fold:
+			controls = append(controls, &Control{Emoji: "❌", Label: "Fold", Command: fold})
+		case table.Check:
+			controls = append(controls, &Control{Emoji: "✅", Label: "Check", Command: check})
+		case table.Call:
+			controls = append(controls, &Control{Emoji: "📞", Label: "Call", Command: call})
+		case table.Bet, table.Raise:
+			canRaise = true
+		}
+	}
+
+	if canRaise {
+		controls = append(controls,
+			&Control{Emoji: "🔼", Label: "Min-raise", Command: raise + " min"},
+			&Control{Emoji: "🍯", Label: "Pot", Command: raise + " pot"},
+		)
+	}
+	controls = append(controls, &Control{Emoji: "💰", Label: "All-in", Command: "all in"})
+	if canRaise {
+		// Asks for the amount to type
+		controls = append(controls, &Control{Emoji: "📝", Label: "Amount", Command: "amount"})
+	}
+	return controls
+}
+
+// Sends the player their hole cards in the style they picked, or the tables
 func (p *TablePlayer) SendCards(player *table.PlayerState) {
+	prefs := p.Table.Cards
+	if style := playerManager.CardStyle(p.Id); style != "" {
+		prefs.Style = style
+	}
+
 	holeCards := player.HoleCards()
 	cards := make([]*hand.Card, len(holeCards))
 	cardsStr := "["
@@ -438,10 +870,13 @@ func (p *TablePlayer) SendCards(player *table.PlayerState) {
 			cardsStr += ", "
 		}
 		cardsStr += string(hc.Card.Rank()) + " " + string(hc.Card.Suit())
+		if hc.Visibility == table.Exposed {
+			cardsStr += " (up)"
+		}
 		cards[k] = hc.Card
 	}
 	cardsStr += "]"
-	go SurelySend(p.PrivateChannel, fmt.Sprintf("Your hand\n```\n%s\n```\n%s", createAsciiCards(cards, " "), cardsStr))
+	SendCards(p.Table.Manager.Transport, "", p.Id, "Your hand", cardsStr, cards, len(cards), prefs)
 }
 
 func (t *Table) printResults(results map[int][]*table.Result) string {
@@ -450,13 +885,61 @@ func (t *Table) printResults(results map[int][]*table.Result) string {
 	players := t.Table.Players()
 	for seat, resultList := range results {
 		for _, result := range resultList {
-			tablePlayer := players[seat].Player().(*TablePlayer)
-			out += fmt.Sprint(tablePlayer.Name+":", result) + "\n"
+			tablePlayer := asTablePlayer(players[seat].Player())
+			line := fmt.Sprint(tablePlayer.Name+":", result)
+			switch result.Share {
+			case table.WonLow, table.SplitLow:
+				line += " (low)"
+			case table.WonHigh, table.SplitHigh:
+				if IsHiLo(t.Table.Game()) {
+					line += " (high)"
+				}
+			}
+			out += line + "\n"
 		}
 	}
 	return out
 }
 
+func cardsString(cards []*hand.Card) string {
+	out := "["
+	for k, c := range cards {
+		if k != 0 {
+			out += ", "
+		}
+		out += string(c.Rank()) + " " + string(c.Suit())
+	}
+	return out + "]"
+}
+
+// Games that can be set with conf set game
+var gameNames = map[string]table.Game{
+	"holdem":    table.Holdem,
+	"omaha":     table.OmahaHi,
+	"omahahi":   table.OmahaHi,
+	"omahahilo": table.OmahaHiLo,
+	"stud":      table.StudHi,
+	"studhi":    table.StudHi,
+	"studhilo":  table.StudHiLo,
+	"razz":      table.Razz,
+}
+
+func ParseGame(name string) (table.Game, error) {
+	game, ok := gameNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return table.Holdem, errors.New("Unknown game, available: holdem, omaha, omahahilo, stud, studhilo, razz")
+	}
+	return game, nil
+}
+
+func IsStud(game table.Game) bool {
+	return game == table.StudHi || game == table.StudHiLo || game == table.Razz
+}
+
+func IsHiLo(game table.Game) bool {
+	return game == table.OmahaHiLo || game == table.StudHiLo
+}
+
 func createAsciiCards(cards []*hand.Card, spacing string) string {
 	lines := make([][]string, 5)
 	for _, card := range cards {
@@ -496,6 +979,9 @@ type Action struct {
 
 	AllIn bool
 
+	AskAmount bool // The amount control, the player is asked to type how much to raise
+	Short     bool // One letter like c for call
+
 	RestMessage string
 }
 
@@ -514,27 +1000,31 @@ func GetAction(input string) *Action {
 			rest = split[1]
 		}
 
-		return &Action{IsTableAction: true, TableAction: ta, RestMessage: rest}
+		return &Action{IsTableAction: true, TableAction: ta, RestMessage: rest, Short: len(split[0]) == 1}
 	}
 
 	if AllInRegex.MatchString(lower) {
 		return &Action{AllIn: true}
 	}
 
+	if strings.TrimSpace(lower) == "amount" {
+		return &Action{AskAmount: true}
+	}
+
 	return nil
 }
 
 func TableAction(input string) (table.Action, error) {
 	switch input {
-	case fold:
+	case fold, "f":
 		return table.Fold, nil
-	case check:
+	case check, "x":
 		return table.Check, nil
-	case call:
+	case call, "c":
 		return table.Call, nil
-	case bet:
+	case bet, "b":
 		return table.Bet, nil
-	case raise:
+	case raise, "r":
 		return table.Raise, nil
 	}
 	return table.Fold, errors.New(input + " is not an action.")
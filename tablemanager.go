@@ -6,7 +6,9 @@ import (
 	"github.com/jonas747/joker/hand"
 	"github.com/jonas747/joker/table"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 type ActionEvt struct {
@@ -21,20 +23,19 @@ type StartEvt struct {
 }
 
 type CreateTableEvt struct {
-	PlayerID       string
-	Name           string
-	PrivateChannel string
-	Channel        string
-	BuyIn          int
-	Small          int
-	Big            int
+	PlayerID string
+	Name     string
+	Channel  string
+	BuyIn    int
+	Small    int
+	Big      int
+	Game     table.Game
 }
 type AddPlayerEvt struct {
-	PlayerID       string
-	Name           string
-	BuyIn          int
-	Channel        string
-	PrivateChannel string
+	PlayerID string
+	Name     string
+	BuyIn    int
+	Channel  string
 }
 
 type RemovePlayerEvt struct {
@@ -43,7 +44,8 @@ type RemovePlayerEvt struct {
 }
 
 type DestroyTableEvt struct {
-	Channel string
+	Channel  string
+	Snapshot *TableSnapshot // Set if the table should be restored on the next startup
 }
 
 type PrintInfoEvt struct {
@@ -56,6 +58,24 @@ type ChangeSettingsEvt struct {
 	Settings map[string]string
 }
 
+type AddBotEvt struct {
+	PlayerID string
+	Channel  string
+	Strategy BotStrategy
+}
+
+type RemoveBotsEvt struct {
+	PlayerID string
+	Channel  string
+}
+
+type EntropyEvt struct {
+	PlayerID string
+	Name     string
+	Channel  string
+	Entropy  string
+}
+
 type StopTableEvt struct {
 	PlayerID string
 	Channel  string
@@ -83,13 +103,99 @@ type TableManager struct {
 
 	EvtChan chan interface{}
 
-	stopWg   *sync.WaitGroup
-	stopping bool
+	stopWg    *sync.WaitGroup
+	stopping  bool
+	snapshots []*TableSnapshot // Tables saved during shutdown
+	mtts      []*MultiTableTournament
+
+	HandLog   *HandLog  // Where finished hands are recorded
+	Transport Transport // Where messages are sent and received
+
+	NewDealer func() hand.Dealer // Creates the dealer for new tables, a SeededDealer if not set
+	HandDelay time.Duration      // Pause between hands, 10 seconds if not set
+	BotDelay  time.Duration      // How long bots think before acting, 2 seconds if not set
+
+	pendingDrift int // Drift seen on the last audit
+	alertedDrift int // Drift the owner was last alerted about
+
+	turnLock sync.Mutex
+	turns    map[string]*turnState
 }
 
 var ErrStop = errors.New("Stopping")
 
+// Called by the transport for every message, actions are passed on to the table
+func (t *TableManager) HandleMessage(m *IncomingMessage) {
+	action := GetAction(m.Content)
+	isTurn, prompted := t.checkTurn(m.ChannelID, m.AuthorID)
+	if action == nil && prompted {
+		action = &Action{IsTableAction: true, TableAction: table.Raise, RestMessage: strings.ToLower(strings.TrimSpace(m.Content))}
+	}
+
+	// Single letters are said in chat all the time, they're only actions from the player whose turn it is
+	if action != nil && (!action.Short || isTurn) {
+		// An action lets pass it to tablemanager
+		t.EvtChan <- &ActionEvt{Action: action, Channel: m.ChannelID, PlayerID: m.AuthorID}
+	}
+}
+
+// Whose turn it is in a channel, kept apart from the table so messages can be checked without locking it
+type turnState struct {
+	playerID string
+	prompted bool // Asked to type an amount, their next message is the raise
+}
+
+// Marks it as the players turn in the channel until EndTurn
+func (t *TableManager) StartTurn(channel, playerID string) {
+	t.turnLock.Lock()
+	defer t.turnLock.Unlock()
+
+	if t.turns == nil {
+		t.turns = make(map[string]*turnState)
+	}
+	t.turns[channel] = &turnState{playerID: playerID}
+}
+
+func (t *TableManager) EndTurn(channel string) {
+	t.turnLock.Lock()
+	delete(t.turns, channel)
+	t.turnLock.Unlock()
+}
+
+// Makes the next message of the player whose turn it is the amount to raise
+func (t *TableManager) PromptAmount(channel string) {
+	t.turnLock.Lock()
+	if turn, ok := t.turns[channel]; ok {
+		turn.prompted = true
+	}
+	t.turnLock.Unlock()
+}
+
+// Returns true if it's the players turn in the channel and if they were asked for an amount, the prompt is used up
+func (t *TableManager) checkTurn(channel, playerID string) (isTurn, prompted bool) {
+	t.turnLock.Lock()
+	defer t.turnLock.Unlock()
+
+	turn, ok := t.turns[channel]
+	if !ok || turn.playerID != playerID {
+		return false, false
+	}
+	prompted = turn.prompted
+	turn.prompted = false
+	return true, prompted
+}
+
+// Sends a message through the transport
+func (t *TableManager) Send(channel, msg string) {
+	t.Transport.SendMessage(channel, msg)
+}
+
 func (t *TableManager) Run() {
+	err := t.RestoreTables()
+	if err != nil {
+		log.Println("Failed restoring tables:", err)
+	}
+
 	for {
 		evt := <-t.EvtChan
 		stopEvt, ok := evt.(*StopEvt)
@@ -99,6 +205,8 @@ func (t *TableManager) Run() {
 			t.stopping = true
 
 			if len(t.tables) < 1 {
+				t.ChopMTTs()
+				t.saveSnapshots()
 				t.stopWg.Done()
 				return
 			}
@@ -108,6 +216,8 @@ func (t *TableManager) Run() {
 			if err != nil {
 				if err == ErrStop {
 					log.Println("Tablemanager is done waiting")
+					t.ChopMTTs()
+					t.saveSnapshots()
 					t.stopWg.Done()
 					return
 				} else {
@@ -118,23 +228,37 @@ func (t *TableManager) Run() {
 	}
 }
 
+func (t *TableManager) saveSnapshots() {
+	err := t.SaveSnapshots()
+	if err != nil {
+		// The chips would be gone otherwise
+		log.Println("Failed saving tables, cashing out everyone at them:", err)
+		for _, snapshot := range t.snapshots {
+			snapshot.CashOut()
+		}
+		t.snapshots = nil
+	}
+}
+
 func (t *TableManager) GracefullShutdown() {
-	// Set tables to last round mode and wait till rounds are over
-	for _, v := range t.tables {
+	// Save stopped tables right away, set running tables to last round mode and wait till rounds are over
+	tables := make([]*Table, len(t.tables))
+	copy(tables, t.tables)
+	for _, v := range tables {
 		v.Lock()
 
 		if !v.Running {
-			for _, p := range v.Table.Players() {
-				cast := p.Player().(*TablePlayer)
-				v.Unlock()
-				GiveMoney(cast.Id, cast.Name, p.Chips())
-				v.Lock()
+			if v.MTT != nil {
+				v.MTT.RecordChop(v)
+			} else {
+				v.RemoveBots()
+				t.snapshots = append(t.snapshots, v.Snapshot())
 			}
 			t.RemoveTable(v.Channel)
 		} else {
 			v.stopAfterDone = true
 			v.serverShuttingDown = true
-			go SurelySend(v.Channel, "Bot is shutting down after all tables has completed...")
+			t.Send(v.Channel, "Bot is shutting down after this hand, the table will be back when it starts again...")
 		}
 
 		v.Unlock()
@@ -173,7 +297,7 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 
 		// Check if there is already a table in this channel
 		if t.GetTable(evt.Channel) != nil {
-			go SurelySend(evt.Channel, "There's already a game running in this channel")
+			t.Send(evt.Channel, "There's already a game running in this channel")
 			return nil
 		}
 
@@ -184,51 +308,53 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 			evt.Big = 2
 		}
 
+		if evt.Game == "" {
+			evt.Game = table.Holdem
+		}
+
 		opts := table.Config{
-			Game:       table.Holdem,
+			Game:       evt.Game,
 			Limit:      table.NoLimit,
 			Stakes:     table.Stakes{SmallBet: evt.Small, BigBet: evt.Big, Ante: 0},
 			NumOfSeats: 10,
 		}
-		coreTable := table.New(opts, hand.NewDealer())
+		tbl := t.NewTable(evt.Channel, evt.PlayerID, evt.Name, opts)
 
-		tbl := &Table{
-			Manager:   t,
-			Table:     coreTable,
-			Channel:   evt.Channel,
-			Owner:     evt.PlayerID,
-			OwnerName: evt.Name,
-			ActionEvt: make(chan *ActionEvt),
-		}
-
-		player := playerManager.GetCreatePlayer(evt.PlayerID, evt.Name)
-		player.Lock()
-		if evt.BuyIn > player.Money {
-			go SurelySend(evt.Channel, "You don't have enough money")
-			player.Unlock()
+		if !TakeMoney(evt.PlayerID, evt.Name, evt.BuyIn, tbl.MoneySource(ReasonBuyIn)) {
+			t.Send(evt.Channel, "You don't have enough money")
 			return nil
 		}
-		player.Money -= evt.BuyIn
-		player.Unlock()
 
 		tp := &TablePlayer{
-			Id:             evt.PlayerID,
-			PrivateChannel: evt.PrivateChannel,
-			Table:          tbl,
-			Name:           evt.Name,
+			Id:    evt.PlayerID,
+			Table: tbl,
+			Name:  evt.Name,
 		}
 
-		err := tbl.Table.Sit(tp, 0, evt.BuyIn)
+		err := tbl.Sit(tp, 0, evt.BuyIn)
 		if err != nil {
 			log.Println("Failed to sit at own table?!?!?", err)
-			go SurelySend(evt.Channel, "Failed to sit at own table.. "+err.Error())
-			player.Lock()
-			player.Money += evt.BuyIn
-			player.Unlock()
+			t.Send(evt.Channel, "Failed to sit at own table.. "+err.Error())
+			GiveMoney(evt.PlayerID, evt.Name, evt.BuyIn, tbl.MoneySource(ReasonRefund))
 			return nil
 		}
 		t.tables = append(t.tables, tbl)
-		go SurelySend(evt.Channel, "Created table, get atleast 2 people to join before you can start")
+		t.Send(evt.Channel, "Created table, get atleast 2 people to join before you can start")
+	case *CreateTournamentEvt:
+		t.CreateTournament(evt)
+	case *CreateMTTEvt:
+		t.CreateMTT(evt)
+	case *MTTRegisterEvt:
+		t.RegisterMTT(evt)
+	case *MTTStartEvt:
+		t.StartMTT(evt)
+	case *MTTUpdateEvt:
+		t.BalanceMTT(evt.MTT)
+	case *MTTInfoEvt:
+		mtt := t.requireMTT(evt.Channel)
+		if mtt != nil {
+			t.Send(evt.Channel, mtt.String())
+		}
 	case *AddPlayerEvt:
 		tbl := t.requireTable(evt.Channel)
 		if tbl == nil {
@@ -236,47 +362,52 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 		}
 
 		tp := &TablePlayer{
-			Id:             evt.PlayerID,
-			PrivateChannel: evt.PrivateChannel,
-			Name:           evt.Name,
+			Id:   evt.PlayerID,
+			Name: evt.Name,
 		}
 
 		if tbl.IsPlayerBanned(evt.PlayerID) {
-			go SurelySend(evt.Channel, "You're banned from this table")
+			t.Send(evt.Channel, "You're banned from this table")
 			return nil
 		}
 
-		player := playerManager.GetCreatePlayer(evt.PlayerID, evt.Name)
-		player.Lock()
-		if player.Money < evt.BuyIn {
-			go SurelySend(evt.Channel, "Not enough money to join")
-			player.Unlock()
+		if tbl.Tournament != nil {
+			t.RegisterTournamentPlayer(tbl, evt)
+			return nil
+		}
+
+		if tbl.MTT != nil {
+			t.Send(evt.Channel, "This table is part of a tournament, register in <#"+tbl.MTT.Lobby+">")
 			return nil
 		}
 
 		// Subtract buyin money
-		player.Money -= evt.BuyIn
-		player.Unlock()
+		if !TakeMoney(evt.PlayerID, evt.Name, evt.BuyIn, tbl.MoneySource(ReasonBuyIn)) {
+			t.Send(evt.Channel, "Not enough money to join")
+			return nil
+		}
 
 		foundSeat := false
 		tbl.Lock()
 		for i := 0; i < tbl.Table.NumOfSeats(); i++ {
-			err := tbl.Table.Sit(tp, i, evt.BuyIn)
+			err := tbl.Sit(tp, i, evt.BuyIn)
 			if err == nil {
 				foundSeat = true
-				go SurelySend(evt.Channel, evt.Name+" Joined the table")
+				if tbl.viewing() {
+					tbl.RefreshView()
+				} else {
+					t.Send(evt.Channel, evt.Name+" Joined the table")
+				}
 				break
 			} else if err != table.ErrSeatOccupied {
-				go SurelySend(evt.Channel, "Error joining table: "+err.Error())
+				t.Send(evt.Channel, "Error joining table: "+err.Error())
 				break
 			}
 		}
 		if !foundSeat {
 			tbl.Unlock()
-			go SurelySend(evt.Channel, "No available seats :(")
-			player.Lock()
-			player.Money += evt.BuyIn
-			player.Unlock()
+			t.Send(evt.Channel, "No available seats :(")
+			GiveMoney(evt.PlayerID, evt.Name, evt.BuyIn, tbl.MoneySource(ReasonRefund))
 		} else {
 			tp.Table = tbl
 			tbl.Unlock()
@@ -292,6 +423,9 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 		tbl.RemovePlayer(evt.PlayerID, false)
 		tbl.Unlock()
 	case *DestroyTableEvt:
+		if evt.Snapshot != nil {
+			t.snapshots = append(t.snapshots, evt.Snapshot)
+		}
 		t.RemoveTable(evt.Channel)
 		if t.stopping {
 			if len(t.tables) == 0 {
@@ -300,13 +434,17 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 				log.Printf("%d tables left before stop\n", len(t.tables))
 			}
 		}
+	case *AuditEvt:
+		t.Audit()
 	case *StartEvt:
 		tbl := t.requireTable(evt.Channel)
 		if tbl != nil {
 			tbl.Lock()
-			if !tbl.Running && len(tbl.Table.Players()) >= 2 {
-				go SurelySend(evt.Channel, "Starting")
-				go tbl.Run()
+			if tbl.IsTournament() {
+				t.Send(evt.Channel, "Tournaments start by themselves, sit and gos when all seats are taken")
+			} else if !tbl.Running && len(tbl.Table.Players()) >= 2 {
+				t.Send(evt.Channel, "Starting")
+				tbl.Start()
 			}
 			tbl.Unlock()
 		}
@@ -327,7 +465,7 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 
 		tbl.Lock()
 		if tbl.Running {
-			go SurelySend(evt.Channel, "Can't change setting while table is running")
+			t.Send(evt.Channel, "Can't change setting while table is running")
 			tbl.Unlock()
 			return nil
 		}
@@ -342,6 +480,43 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 		}
 		t.SendTableInfo(evt.Channel, tbl)
 		tbl.Unlock()
+	case *AddBotEvt:
+		tbl := t.requireTable(evt.Channel)
+		if tbl == nil {
+			return nil
+		}
+
+		tbl.Lock()
+		if t.requireOwner(tbl, evt.PlayerID) {
+			bot, err := tbl.AddBot(evt.Strategy)
+			if err != nil {
+				t.Send(evt.Channel, err.Error())
+			} else {
+				t.Send(evt.Channel, bot.Name+" Joined the table")
+			}
+		}
+		tbl.Unlock()
+	case *RemoveBotsEvt:
+		tbl := t.requireTable(evt.Channel)
+		if tbl == nil {
+			return nil
+		}
+
+		tbl.Lock()
+		if t.requireOwner(tbl, evt.PlayerID) {
+			tbl.RemoveBots()
+			t.Send(evt.Channel, "Bots are leaving the table")
+		}
+		tbl.Unlock()
+	case *EntropyEvt:
+		tbl := t.requireTable(evt.Channel)
+		if tbl == nil {
+			return nil
+		}
+
+		tbl.Lock()
+		t.AddEntropy(tbl, evt)
+		tbl.Unlock()
 	case *StopTableEvt:
 		tbl := t.requireTable(evt.Channel)
 		if tbl == nil {
@@ -359,7 +534,7 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 			return nil
 		}
 		tbl.Lock()
-		if t.requireOwner(tbl, evt.PlayerID) {
+		if t.requireOwner(tbl, evt.PlayerID) && t.requireNotStarted(tbl) {
 			tbl.RemovePlayer(evt.KickPlayerID, true)
 		}
 		tbl.Unlock()
@@ -370,11 +545,14 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 		}
 
 		tbl.Lock()
-		if t.requireOwner(tbl, evt.PlayerID) {
+		if t.requireOwner(tbl, evt.PlayerID) && t.requireNotStarted(tbl) {
 			tbl.RemovePlayer(evt.BanPlayerID, true)
-			if !tbl.IsPlayerBanned(evt.PlayerID) {
-				tbl.BannedPlayers = append(tbl.BannedPlayers, evt.PlayerID)
+			if !tbl.IsPlayerBanned(evt.BanPlayerID) {
+				tbl.BannedPlayers = append(tbl.BannedPlayers, evt.BanPlayerID)
 			}
+			go func() {
+				t.Send(evt.Channel, "**"+t.Transport.UserName(evt.BanPlayerID)+"** is banned from this table")
+			}()
 		}
 		tbl.Unlock()
 	}
@@ -382,9 +560,87 @@ func (t *TableManager) HandleEvent(e interface{}) error {
 	return nil
 }
 
+// Creates a new table that's not yet added to the tablemanager
+func (t *TableManager) NewTable(channel, owner, ownerName string, opts table.Config) *Table {
+	tbl := &Table{
+		Manager:   t,
+		Dealer:    t.dealer(),
+		Channel:   channel,
+		Owner:     owner,
+		OwnerName: ownerName,
+		ActionEvt: make(chan *ActionEvt),
+		Bank:      economies.BankFor(t.Transport.GuildID(channel)),
+	}
+	tbl.Table = table.New(opts, &tableDealer{t: tbl})
+	return tbl
+}
+
+// Mixes the players entropy into the next deck, table should be locked
+func (t *TableManager) AddEntropy(tbl *Table, evt *EntropyEvt) {
+	dealer, ok := tbl.Dealer.(*FairDealer)
+	if !ok {
+		t.Send(evt.Channel, "This table isn't provably fair, the owner can turn it on with `conf set fair on`")
+		return
+	}
+
+	seated := false
+	for _, p := range tbl.Table.Players() {
+		if p.Player().ID() == evt.PlayerID {
+			seated = true
+		}
+	}
+	if !seated {
+		t.Send(evt.Channel, "Only players at the table can add entropy")
+		return
+	}
+
+	err := dealer.AddEntropy(evt.Entropy)
+	if err != nil {
+		t.Send(evt.Channel, err.Error())
+		return
+	}
+	t.Send(evt.Channel, "Mixed "+evt.Name+"'s entropy into the next hand")
+}
+
+func (t *TableManager) dealer() hand.Dealer {
+	if t.NewDealer != nil {
+		return t.NewDealer()
+	}
+	return NewSeededDealer()
+}
+
+func (t *TableManager) botDelay() time.Duration {
+	if t.BotDelay < 1 {
+		return time.Second * 2
+	}
+	return t.BotDelay
+}
+
+func (t *TableManager) handDelay() time.Duration {
+	if t.HandDelay < 1 {
+		return time.Second * 10
+	}
+	return t.HandDelay
+}
+
 func (t *TableManager) requireOwner(tbl *Table, id string) bool {
+	if tbl.MTT != nil {
+		t.Send(tbl.Channel, "Tournament tables are run by the tournament, nobody can change them")
+		return false
+	}
+
 	if tbl.Owner != id {
-		go SurelySend(tbl.Channel, "Only owner of table can do this")
+		t.Send(tbl.Channel, "Only owner of table can do this")
+		return false
+	}
+
+	return true
+}
+
+// Players can't be kicked or banned from a tournament that started, they paid to play it out
+func (t *TableManager) requireNotStarted(tbl *Table) bool {
+	if tbl.TournamentStarted() {
+		t.Send(tbl.Channel, "Can't remove players from a tournament after it started")
 		return false
 	}
 
@@ -395,7 +651,7 @@ func (t *TableManager) requireOwner(tbl *Table, id string) bool {
 func (t *TableManager) requireTable(channel string) *Table {
 	tbl := t.GetTable(channel)
 	if tbl == nil {
-		go SurelySend(channel, "No table in this channel")
+		t.Send(channel, "No table in this channel")
 	}
 	return tbl
 }
@@ -404,7 +660,7 @@ func (t *TableManager) RemoveTable(channel string) {
 	for k, tbl := range t.tables {
 		if tbl.Channel == channel {
 			t.tables = append(t.tables[:k], t.tables[k+1:]...)
-			go SurelySend(channel, "Destroyed table baibai")
+			t.Send(channel, "Destroyed table baibai")
 			break
 		}
 	}
@@ -416,14 +672,30 @@ func (t *TableManager) SendTableInfo(channel string, tbl *Table) {
 	tableConfigStr := fmt.Sprintf("Table Config:\n - Owner: %s\n - Game: **%s**\n - Timeout: **%d**\n - Seats: **%d**\n - Limit: **%s**\n - Stakes (small, big, ante): **%d**, **%d**, **%d**\n",
 		tbl.OwnerName, tbl.Table.Game().String(), tbl.GetTimeout(), tbl.Table.NumOfSeats(), tbl.Table.Limit(), stakes.SmallBet, stakes.BigBet, stakes.Ante)
 
+	if tbl.Blinds != nil {
+		tableConfigStr += " - Blinds: " + tbl.Blinds.String() + ", " + tbl.Blinds.UntilNext() + "\n"
+	}
+
+	if tbl.IsFair() {
+		tableConfigStr += " - Provably fair: **on**\n"
+	}
+	if tbl.View {
+		tableConfigStr += " - Table view: **on**\n"
+	}
+	tableConfigStr += " - Cards: " + tbl.Cards.String() + "\n"
+
+	if tbl.Tournament != nil {
+		tableConfigStr += "\n" + tbl.Tournament.String()
+	}
+
 	playersStr := ""
 
 	for k, v := range tbl.Table.Players() {
-		tablePlayer := v.Player().(*TablePlayer)
+		tablePlayer := asTablePlayer(v.Player())
 		playersStr += fmt.Sprintf("Seat [%d] %s: $%d\n", k, tablePlayer.Name, v.Chips())
 	}
 
-	go SurelySend(channel, tableConfigStr+"\n"+playersStr+"\n+You can change settings using conf set {setting} {value}")
+	t.Send(channel, tableConfigStr+"\n"+playersStr+"\n+You can change settings using conf set {setting} {value}")
 }
 
 func (t *TableManager) GetTable(channel string) *Table {
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/joker/table"
+	"strconv"
+	"strings"
+)
+
+const DefaultTournamentStack = 1500
+
+type CreateTournamentEvt struct {
+	PlayerID string
+	Name     string
+	Channel  string
+	BuyIn    int
+	Seats    int
+}
+
+// A sit and go tournament, everyone pays the same buy in and gets the same stack.
+// It starts when all seats are filled and players who bust are out, when one player is left the prize pool is paid out.
+type Tournament struct {
+	BuyIn  int
+	Seats  int
+	Stack  int   // Starting stack everyone gets
+	Prizes []int // Percentage of the prize pool paid to each place, starting with 1st
+	Pool   int   // Money collected from buy ins that hasn't been paid out
+
+	Started    bool
+	Eliminated []*TournamentEntrant // In the order they got knocked out
+}
+
+type TournamentEntrant struct {
+	ID   string
+	Name string
+}
+
+// Default prize structures, bigger tables pays more places
+func DefaultPrizes(seats int) []int {
+	switch {
+	case seats <= 3:
+		return []int{100}
+	case seats <= 6:
+		return []int{65, 35}
+	default:
+		return []int{50, 30, 20}
+	}
+}
+
+// Parses a prize structure like "50,30,20", the percentages have to add up to 100
+func ParsePrizes(str string, seats int) ([]int, error) {
+	split := strings.Split(str, ",")
+	if len(split) > seats {
+		return nil, errors.New("Can't pay more places than there are seats")
+	}
+
+	prizes := make([]int, len(split))
+	total := 0
+	for k, v := range split {
+		parsed, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(v, "%")))
+		if err != nil || parsed < 1 {
+			return nil, errors.New("Prizes has to be a list of percentages, like 50,30,20")
+		}
+		prizes[k] = parsed
+		total += parsed
+	}
+
+	if total != 100 {
+		return nil, errors.New("Prizes has to add up to 100%")
+	}
+	return prizes, nil
+}
+
+func (tr *Tournament) String() string {
+	prizes := make([]string, len(tr.Prizes))
+	for k, v := range tr.Prizes {
+		prizes[k] = strconv.Itoa(v) + "%"
+	}
+
+	return fmt.Sprintf("Tournament:\n - Buy in: **$%d**\n - Prize pool: **$%d**\n - Starting stack: **%d**\n - Prizes: **%s**\n",
+		tr.BuyIn, tr.Pool, tr.Stack, strings.Join(prizes, ", "))
+}
+
+func (t *TableManager) CreateTournament(evt *CreateTournamentEvt) {
+	if t.GetTable(evt.Channel) != nil {
+		t.Send(evt.Channel, "There's already a game running in this channel")
+		return
+	}
+
+	if evt.Seats < 2 || evt.Seats > 10 {
+		t.Send(evt.Channel, "A tournament needs between 2 and 10 seats")
+		return
+	}
+
+	if evt.BuyIn < 1 {
+		t.Send(evt.Channel, "Buy in has to be atleast $1")
+		return
+	}
+
+	opts := table.Config{
+		Game:       table.Holdem,
+		Limit:      table.NoLimit,
+		Stakes:     table.Stakes{SmallBet: 10, BigBet: 20, Ante: 0},
+		NumOfSeats: evt.Seats,
+	}
+
+	tbl := t.NewTable(evt.Channel, evt.PlayerID, evt.Name, opts)
+	tbl.Blinds, _ = ParseBlindSchedule("standard", opts.Stakes.SmallBet)
+	tbl.Tournament = &Tournament{
+		BuyIn:  evt.BuyIn,
+		Seats:  evt.Seats,
+		Stack:  DefaultTournamentStack,
+		Prizes: DefaultPrizes(evt.Seats),
+	}
+
+	joined := t.RegisterTournamentPlayer(tbl, &AddPlayerEvt{
+		PlayerID: evt.PlayerID,
+		Name:     evt.Name,
+		Channel:  evt.Channel,
+	})
+	if !joined {
+		return
+	}
+
+	t.tables = append(t.tables, tbl)
+	t.Send(evt.Channel, fmt.Sprintf("Created a %d seat tournament with a $%d buy in, it starts when all seats are taken. Join with `tournament join`", evt.Seats, evt.BuyIn))
+}
+
+// Registers a player for the tournament, returns false if he could not be registered
+func (t *TableManager) RegisterTournamentPlayer(tbl *Table, evt *AddPlayerEvt) bool {
+	tbl.Lock()
+	defer tbl.Unlock()
+
+	tr := tbl.Tournament
+	if tr.Started || tbl.Running {
+		t.Send(evt.Channel, "Registration for this tournament is closed")
+		return false
+	}
+
+	if !TakeMoney(evt.PlayerID, evt.Name, tr.BuyIn, tbl.MoneySource(ReasonBuyIn)) {
+		t.Send(evt.Channel, fmt.Sprintf("Not enough money to join, the buy in is $%d", tr.BuyIn))
+		return false
+	}
+
+	tp := &TablePlayer{
+		Id:    evt.PlayerID,
+		Name:  evt.Name,
+		Table: tbl,
+	}
+
+	foundSeat := false
+	for i := 0; i < tbl.Table.NumOfSeats(); i++ {
+		err := tbl.Sit(tp, i, tr.Stack)
+		if err == nil {
+			foundSeat = true
+			break
+		} else if err != table.ErrSeatOccupied {
+			t.Send(evt.Channel, "Error joining tournament: "+err.Error())
+			break
+		}
+	}
+
+	if !foundSeat {
+		GiveMoney(evt.PlayerID, evt.Name, tr.BuyIn, tbl.MoneySource(ReasonRefund))
+		return false
+	}
+
+	tr.Pool += tr.BuyIn
+	registered := len(tbl.Table.Players())
+	t.Send(evt.Channel, fmt.Sprintf("%s registered (%d/%d)", evt.Name, registered, tr.Seats))
+
+	if registered >= tr.Seats {
+		t.Send(evt.Channel, "All seats taken, starting the tournament")
+		tbl.Start()
+	}
+	return true
+}
+
+// Returns true if the sit and go has started, after that nobody but the player himself can take him out of it
+// and the stakes stay as they are. Table should be locked
+func (t *Table) TournamentStarted() bool {
+	return t.Tournament != nil && t.Tournament.Started
+}
+
+// Settings that can't be changed once a tournament started, they'd let the owner push the others out
+var tournamentLockedSettings = map[string]bool{
+	"smallbet": true, "small": true, "bigbet": true, "big": true, "ante": true, "limit": true, "seats": true,
+	"timeout": true, "blinds": true, "schedule": true, "prizes": true, "stack": true, "game": true,
+}
+
+// Removes a player that wants to leave the tournament, before it starts he gets the buy in back
+func (t *Table) LeaveTournament(p *table.PlayerState) {
+	if t.Tournament.Started {
+		t.Eliminate(p)
+		return
+	}
+
+	tablePlayer := asTablePlayer(p.Player())
+	t.Stand(p)
+	t.Tournament.Pool -= t.Tournament.BuyIn
+	GiveMoney(tablePlayer.Id, tablePlayer.Name, t.Tournament.BuyIn, t.MoneySource(ReasonRefund))
+	t.Send("**" + tablePlayer.Name + "** unregistered from the tournament")
+	t.CheckReplaceOwner()
+}
+
+// Knocks a player out of the tournament, his chips are gone with him
+func (t *Table) Eliminate(p *table.PlayerState) {
+	tablePlayer := asTablePlayer(p.Player())
+	t.Stand(p)
+	t.CheckReplaceOwner()
+
+	entrant := &TournamentEntrant{ID: tablePlayer.Id, Name: tablePlayer.Name}
+	if t.MTT != nil {
+		place := t.MTT.Eliminate(entrant)
+		msg := fmt.Sprintf("**%s** is out of the tournament in %s place", tablePlayer.Name, ordinal(place))
+		t.Send(msg)
+		t.Manager.Send(t.MTT.Lobby, msg)
+		return
+	}
+
+	t.Tournament.Eliminated = append(t.Tournament.Eliminated, entrant)
+	place := len(t.Table.Players()) + 1
+	t.Send(fmt.Sprintf("**%s** is out of the tournament in %s place", tablePlayer.Name, ordinal(place)))
+}
+
+// Eliminates everyone that busted in the last hand
+func (t *Table) EliminateBusted() {
+	for seat := 0; seat < t.Table.NumOfSeats(); seat++ {
+		p, ok := t.Table.Players()[seat]
+		if ok && p.Chips() < 1 {
+			t.Eliminate(p)
+		}
+	}
+}
+
+// Pays out the prize pool to the winner and the last ones knocked out
+func (t *Table) FinishTournament() {
+	tr := t.Tournament
+
+	places := make([]*TournamentEntrant, 0, len(tr.Prizes))
+	for _, p := range t.Table.Players() {
+		tablePlayer := asTablePlayer(p.Player())
+		places = append(places, &TournamentEntrant{ID: tablePlayer.Id, Name: tablePlayer.Name})
+	}
+	for i := len(tr.Eliminated) - 1; i >= 0; i-- {
+		places = append(places, tr.Eliminated[i])
+	}
+
+	// Pay out the lower places first so rounding leftovers go to the winner
+	out := ""
+	paid := make([]int, len(places))
+	pool := tr.Pool
+	for i := len(tr.Prizes) - 1; i >= 0; i-- {
+		if i >= len(places) {
+			continue
+		}
+
+		prize := pool * tr.Prizes[i] / 100
+		if i == 0 {
+			prize = tr.Pool
+		}
+		paid[i] = prize
+		tr.Pool -= prize
+	}
+
+	for i, entrant := range places {
+		if paid[i] > 0 {
+			GiveMoney(entrant.ID, entrant.Name, paid[i], t.MoneySource(ReasonPrize))
+		}
+		out += fmt.Sprintf("%s: **%s** $%d\n", ordinal(i+1), entrant.Name, paid[i])
+	}
+
+	t.Send("Tournament is over!\n" + out)
+
+	go func() {
+		t.Manager.EvtChan <- &DestroyTableEvt{Channel: t.Channel}
+	}()
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// Changes the starting stack, everyone already registered gets the new stack
+func (t *Table) setTournamentStack(stack int) {
+	t.Tournament.Stack = stack
+	for seat, p := range t.Table.Players() {
+		tablePlayer := asTablePlayer(p.Player())
+		t.Stand(p)
+		t.Sit(tablePlayer, seat, stack)
+	}
+}
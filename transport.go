@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transport is how the game talks to players, the tables and the tablemanager only go through this
+// so they don't care if it's discord or something else on the other end
+type Transport interface {
+	// SendMessage sends a message to a channel, failures are logged by the transport
+	SendMessage(channel, msg string)
+
+	// SendPrivateMessage sends a message only the user can see
+	SendPrivateMessage(userID, msg string)
+
+	// SendFile sends a message with a file attached, like a picture of the cards
+	SendFile(channel, msg, name string, data []byte)
+
+	// SendPrivateFile sends a message with a file attached only the user can see
+	SendPrivateFile(userID, msg, name string, data []byte)
+
+	// SendControls sends a message with controls, pressing one is handled as if the user sent the controls command
+	// in the channel. Only the last controls sent to a channel can be pressed
+	SendControls(channel, msg string, controls []*Control)
+
+	// SendView sends a message that can be edited later and returns its id, empty if it failed. Controls work like
+	// with SendControls
+	SendView(channel string, view *View, controls []*Control) string
+
+	// EditView changes what the view shows and replaces its controls
+	EditView(channel, viewID string, view *View, controls []*Control)
+
+	// UserName returns the name of a user, or the id if it can't be found
+	UserName(userID string) string
+
+	// GuildID returns the guild (or server) the channel is in, empty if it's not in one
+	GuildID(channel string) string
+
+	// IsAdmin returns true if the user is allowed to manage the guild the channel is in
+	IsAdmin(userID, channel string) bool
+
+	// Run starts receiving messages, handler is called for every message someone sends
+	Run(handler func(m *IncomingMessage)) error
+}
+
+// Something a player can press instead of typing a command
+type Control struct {
+	Emoji   string
+	Label   string
+	Command string
+}
+
+// A message that's kept up to date by editing it, discord shows it as an embed
+type View struct {
+	Title       string
+	Description string
+	Fields      []*ViewField
+	Footer      string
+	Deadline    time.Time // Shown as a countdown if set
+}
+
+type ViewField struct {
+	Name  string
+	Value string
+}
+
+// Returns the view as plain text for transports that can't do better
+func (v *View) String() string {
+	out := "**" + v.Title + "**\n"
+	if v.Description != "" {
+		out += v.Description + "\n"
+	}
+	if !v.Deadline.IsZero() {
+		out += fmt.Sprintf("Time left: %ds\n", int(time.Until(v.Deadline).Seconds()+0.5))
+	}
+	for _, f := range v.Fields {
+		out += "**" + f.Name + "**\n" + f.Value + "\n"
+	}
+	if v.Footer != "" {
+		out += "_" + v.Footer + "_\n"
+	}
+	return out
+}
+
+// A message received by a transport
+type IncomingMessage struct {
+	ChannelID  string
+	AuthorID   string
+	AuthorName string
+	Content    string
+}
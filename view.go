@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jonas747/joker/hand"
+	"github.com/jonas747/joker/table"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveView keeps the table view message of a hand up to date. Updates are sent in order from one goroutine at a
+// time, the ones that come in while it's busy are dropped for the newest so bursts end up as one edit
+type liveView struct {
+	sync.Mutex
+	transport Transport
+	channel   string
+
+	id      string      // Message being edited, empty if a new one should be sent
+	pending *viewUpdate // Next update to send
+	sending bool
+}
+
+type viewUpdate struct {
+	view     *View
+	controls []*Control
+	fresh    bool // Send a new message instead of editing the last one
+}
+
+func (lv *liveView) update(u *viewUpdate) {
+	lv.Lock()
+	if lv.pending != nil && lv.pending.fresh {
+		u.fresh = true
+	}
+	lv.pending = u
+	if lv.sending {
+		lv.Unlock()
+		return
+	}
+	lv.sending = true
+	lv.Unlock()
+
+	go lv.send()
+}
+
+func (lv *liveView) send() {
+	lv.Lock()
+	for lv.pending != nil {
+		u := lv.pending
+		lv.pending = nil
+		if u.fresh {
+			lv.id = ""
+		}
+		id := lv.id
+		lv.Unlock()
+
+		if id == "" {
+			id = lv.transport.SendView(lv.channel, u.view, u.controls)
+		} else {
+			lv.transport.EditView(lv.channel, id, u.view, u.controls)
+		}
+
+		lv.Lock()
+		lv.id = id
+	}
+	lv.sending = false
+	lv.Unlock()
+}
+
+// What the view is showing at the top, kept so it can be shown again when something else changes
+type viewStatus struct {
+	text     string
+	controls []*Control
+	deadline time.Time
+}
+
+// Returns true if the table is shown in a single message per hand, table should be locked
+func (t *Table) viewing() bool {
+	return t.View && t.Running
+}
+
+// Starts a new view message for the next update, table should be locked
+func (t *Table) newView() {
+	t.viewFresh = true
+}
+
+// Updates the table view with the status at the top, like whose turn it is. Controls can be pressed on the view
+// and deadline is shown as a countdown. Table should be locked
+func (t *Table) UpdateView(status string, controls []*Control, deadline time.Time) {
+	t.viewStatus = &viewStatus{text: status, controls: controls, deadline: deadline}
+	t.RefreshView()
+}
+
+// Shows the current state of the table in the view with the last status, table should be locked
+func (t *Table) RefreshView() {
+	if !t.viewing() {
+		return
+	}
+	if t.liveView == nil {
+		t.liveView = &liveView{transport: t.Manager.Transport, channel: t.Channel}
+	}
+
+	status := t.viewStatus
+	if status == nil {
+		status = &viewStatus{}
+	}
+
+	t.liveView.update(&viewUpdate{view: t.buildView(status), controls: status.controls, fresh: t.viewFresh})
+	t.viewFresh = false
+}
+
+func (t *Table) buildView(status *viewStatus) *View {
+	stakes := t.Table.Stakes()
+	view := &View{
+		Title:       fmt.Sprintf("%s %d/%d, hand #%d", t.Table.Game(), stakes.SmallBet, stakes.BigBet, t.Hands),
+		Description: status.text,
+		Deadline:    status.deadline,
+		Footer:      "conf set view off to get a message for everything again",
+	}
+
+	if last := t.lastActionString(); last != "" {
+		if view.Description != "" {
+			view.Description += "\n"
+		}
+		view.Description += "Last action: " + last
+	}
+
+	if !IsStud(t.Table.Game()) {
+		board := "-"
+		if cards := t.Table.Board(); t.inHand && len(cards) > 0 {
+			board = emojiCards(cards)
+		}
+		view.Fields = append(view.Fields, &ViewField{Name: "Board", Value: board})
+	}
+
+	pot := 0
+	if t.inHand {
+		pot = t.Table.Pot().Chips()
+	}
+	view.Fields = append(view.Fields, &ViewField{Name: "Pot", Value: fmt.Sprintf("%d", pot)})
+	view.Fields = append(view.Fields, &ViewField{Name: "Seats", Value: t.seatLines()})
+	return view
+}
+
+// One line per seated player with their stack and what they did this street
+func (t *Table) seatLines() string {
+	bets := make(map[int]int)
+	if t.inHand {
+		bets = t.streetBets()
+	}
+
+	var current *table.PlayerState
+	if t.inHand {
+		current = t.Table.CurrentPlayer()
+	}
+
+	players := t.Table.Players()
+	seats := make([]int, 0, len(players))
+	for seat := range players {
+		seats = append(seats, seat)
+	}
+	sort.Ints(seats)
+
+	lines := make([]string, 0, len(seats))
+	for _, seat := range seats {
+		p := players[seat]
+		tablePlayer := asTablePlayer(p.Player())
+		line := fmt.Sprintf("`%d` %s **%d**", seat, tablePlayer.Name, p.Chips())
+
+		if t.inHand {
+			if bet := bets[seat]; bet > 0 {
+				line += fmt.Sprintf(", bet %d", bet)
+			}
+			if p.Out() {
+				line += ", folded"
+			} else if p.AllIn() {
+				line += ", all in"
+			}
+
+			if IsStud(t.Table.Game()) && !p.Out() {
+				up := make([]*hand.Card, 0)
+				for _, hc := range p.HoleCards() {
+					if hc.Visibility == table.Exposed {
+						up = append(up, hc.Card)
+					}
+				}
+				if len(up) > 0 {
+					line += " " + emojiCards(up)
+				}
+			}
+		}
+
+		if current != nil && current.Seat() == seat {
+			line += " ◀"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Returns the last thing a player did this hand, like "**bob** raise 40"
+func (t *Table) lastActionString() string {
+	if t.history == nil || len(t.history.Actions) < 1 {
+		return ""
+	}
+
+	a := t.history.Actions[len(t.history.Actions)-1]
+	name := fmt.Sprintf("seat %d", a.Seat)
+	if p, ok := t.Table.Players()[a.Seat]; ok {
+		name = asTablePlayer(p.Player()).Name
+	}
+
+	out := fmt.Sprintf("**%s** %s", name, a.Action)
+	if a.Amount > 0 {
+		out += fmt.Sprintf(" %d", a.Amount)
+	}
+	if a.AllIn {
+		out += ", all in"
+	}
+	return out
+}